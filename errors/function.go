@@ -10,17 +10,22 @@ import (
 )
 
 // Cause 通过循环 Unwrap ,它将找到最初的错误.
-// 除非提供的 err 是 nil, 否则 Unwrap 不应该返回 nil
+// 除非提供的 err 是 nil, 否则 Unwrap 不应该返回 nil. 如果返回了 nil(如 NewErr), 当前错误就是最初的错误
 func Cause(err error) error {
 	for err != nil {
+		var next error
 		switch i := err.(type) {
 		case UnWrapper:
-			err = i.Unwrap()
+			next = i.Unwrap()
 		case causer:
-			err = i.Cause()
+			next = i.Cause()
 		default:
 			return err
 		}
+		if next == nil {
+			return err
+		}
+		err = next
 	}
 	return err
 }
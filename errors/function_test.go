@@ -0,0 +1,24 @@
+package errors_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/smallsung/gopkg/errors"
+)
+
+func TestCause(t *testing.T) {
+	if cause := errors.Cause(errors.Annotate(io.EOF, "注释信息")); cause != io.EOF {
+		t.Fatalf("want io.EOF, got %v", cause)
+	}
+
+	// NewErr 的 Unwrap 返回 nil, 它本身就是最初的错误
+	annotated := errors.Annotate(errors.NewErr("最初的错误"), "注释信息")
+	if cause := errors.Cause(annotated); cause == nil || cause.Error() != "最初的错误" {
+		t.Fatalf("want NewErr, got %v", cause)
+	}
+	if details := errors.Details(annotated); !strings.Contains(details, "最初的错误") || !strings.Contains(details, "注释信息") {
+		t.Fatalf("unexpected details:\n%s", details)
+	}
+}
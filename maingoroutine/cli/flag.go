@@ -60,6 +60,19 @@ var (
 		Destination: nil,
 		HasBeenSet:  false,
 	}
+	EnableMetricsFlag = cli.BoolFlag{
+		Name:        "metrics.enable",
+		Aliases:     nil,
+		Usage:       "",
+		EnvVars:     nil,
+		FilePath:    "",
+		Required:    false,
+		Hidden:      false,
+		Value:       false,
+		DefaultText: "",
+		Destination: nil,
+		HasBeenSet:  false,
+	}
 )
 
 type Flags struct {
@@ -67,6 +80,7 @@ type Flags struct {
 	HTTPHostFlag      cli.StringFlag
 	HTTPPortFlag      cli.UintFlag
 	EnableHTTPRPCFlag cli.BoolFlag
+	EnableMetricsFlag cli.BoolFlag
 }
 
 func (f Flags) ToSlice() []cli.Flag {
@@ -75,6 +89,7 @@ func (f Flags) ToSlice() []cli.Flag {
 		&f.HTTPHostFlag,
 		&f.HTTPPortFlag,
 		&f.EnableHTTPRPCFlag,
+		&f.EnableMetricsFlag,
 	}
 }
 
@@ -84,6 +99,7 @@ func Default() Flags {
 		HTTPHostFlag:      HTTPHostFlag,
 		HTTPPortFlag:      HTTPPortFlag,
 		EnableHTTPRPCFlag: EnableHTTPRPCFlag,
+		EnableMetricsFlag: EnableMetricsFlag,
 	}
 }
 
@@ -104,5 +120,8 @@ func Parse(ctx *cli.Context, config *maingoroutine.Config) error {
 	if ctx.IsSet(EnableHTTPRPCFlag.Name) {
 		config.EnableHTTPRPC = ctx.Bool(EnableHTTPRPCFlag.Name)
 	}
+	if ctx.IsSet(EnableMetricsFlag.Name) {
+		config.EnableMetrics = ctx.Bool(EnableMetricsFlag.Name)
+	}
 	return nil
 }
@@ -11,4 +11,6 @@ type Config struct {
 	HTTPHost      string
 	HTTPPort      uint16
 	EnableHTTPRPC bool
+	// EnableMetrics 在 http 服务的 MetricsPath 输出 Prometheus 格式的监控指标
+	EnableMetrics bool
 }
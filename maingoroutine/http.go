@@ -12,6 +12,7 @@ import (
 	"github.com/smallsung/gopkg/errors"
 	"github.com/smallsung/gopkg/rpc"
 	"github.com/smallsung/gopkg/rpc/jsonrpc"
+	"github.com/smallsung/gopkg/rpc/msgpackrpc"
 	"go.uber.org/zap"
 )
 
@@ -24,6 +25,9 @@ var (
 	ErrHttpServerRunning = fmt.Errorf("http server already running")
 )
 
+// MetricsPath Config.EnableMetrics 时输出监控指标的路径
+const MetricsPath = "/metrics"
+
 type httpServer struct {
 	host     string
 	port     uint16
@@ -37,7 +41,8 @@ type httpServer struct {
 	httpServer   *http.Server
 	httpServeMux http.ServeMux
 
-	rpcSupper atomic.Value
+	rpcSupper  atomic.Value
+	rpcMetrics *rpc.ServerMetrics
 }
 
 func newHttpServer() *httpServer {
@@ -121,7 +126,10 @@ func (hs *httpServer) enableRPC(apis []API) error {
 		return errors.New("JSON-RPC over HTTP is already enabled")
 	}
 	rpcServer := rpc.NewServer(jsonrpc.NewServerCodec)
+	rpcServer.MediaType = jsonrpc.ContentType
+	rpcServer.RegisterCodec(msgpackrpc.ContentType, msgpackrpc.NewHTTPServerCodec)
 	rpcServer.Logger = hs.logger.Named("rpc")
+	rpcServer.Metrics = hs.rpcMetrics
 
 	for _, api := range apis {
 		if api.Public {
@@ -147,9 +155,10 @@ func (hs *httpServer) disableRPC() {
 	}
 }
 
-func wrapJsonRPCHttpHandler(rpcHandler http.Handler) http.Handler {
+// wrapJsonRPCHttpHandler 接受 rpcServer 注册的所有媒体类型
+func wrapJsonRPCHttpHandler(rpcServer *rpc.Server) http.Handler {
 	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
-		jsonrpc.HttpHandlers.ValidHeader.ServeHTTP(response, request)
-		rpcHandler.ServeHTTP(response, request)
+		jsonrpc.ValidHeader(rpcServer.ContentTypes()...).ServeHTTP(response, request)
+		rpcServer.ServeHTTP(response, request)
 	})
 }
@@ -9,6 +9,7 @@ import (
 	"syscall"
 
 	"github.com/smallsung/gopkg/errors"
+	"github.com/smallsung/gopkg/metrics"
 	"github.com/smallsung/gopkg/rpc"
 	"github.com/smallsung/gopkg/rpc/jsonrpc"
 	"go.uber.org/zap"
@@ -41,6 +42,8 @@ type Goroutine struct {
 	httpServer *httpServer
 
 	inProcRPCServer *rpc.Server
+
+	metrics *metrics.Registry
 }
 
 func New(config Config) (stack *Goroutine) {
@@ -52,15 +55,28 @@ func New(config Config) (stack *Goroutine) {
 		stack.logger = zap.NewNop()
 	}
 
+	stack.metrics = metrics.NewRegistry()
+	rpcMetrics := rpc.NewServerMetrics(stack.metrics)
+
 	stack.httpServer = newHttpServer()
 	stack.httpServer.logger = stack.logger.Named("http")
+	stack.httpServer.rpcMetrics = rpcMetrics
+	if config.EnableMetrics {
+		stack.httpServer.httpServeMux.Handle(MetricsPath, stack.metrics)
+	}
 
 	stack.inProcRPCServer = rpc.NewServer(jsonrpc.NewServerCodec)
 	stack.inProcRPCServer.Logger = stack.logger.Named("rpc")
+	stack.inProcRPCServer.Metrics = rpcMetrics
 	stack.apis = append(stack.apis, stack.builtinAPIs()...)
 	return stack
 }
 
+// Metrics 返回监控指标的注册表,服务可以注册自己的指标
+func (g *Goroutine) Metrics() *metrics.Registry {
+	return g.metrics
+}
+
 func (g *Goroutine) Start() error {
 	g.startStopLock.Lock()
 	defer g.startStopLock.Unlock()
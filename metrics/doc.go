@@ -0,0 +1,3 @@
+// Package metrics
+// 简单的监控指标,以 Prometheus 文本格式输出.避免引入 github.com/prometheus/client_golang
+package metrics
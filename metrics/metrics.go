@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets 默认的直方图区间(秒)
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type float64Value struct {
+	bits uint64
+}
+
+func (v *float64Value) add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&v.bits)
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&v.bits, old, next) {
+			return
+		}
+	}
+}
+
+func (v *float64Value) set(value float64) { atomic.StoreUint64(&v.bits, math.Float64bits(value)) }
+func (v *float64Value) get() float64      { return math.Float64frombits(atomic.LoadUint64(&v.bits)) }
+
+// Counter 只增不减的计数器
+type Counter struct{ v float64Value }
+
+func (c *Counter) Inc() { c.v.add(1) }
+
+// Add delta 小于 0 时忽略
+func (c *Counter) Add(delta float64) {
+	if delta > 0 {
+		c.v.add(delta)
+	}
+}
+
+func (c *Counter) Value() float64 { return c.v.get() }
+
+// Gauge 可增可减的瞬时值
+type Gauge struct{ v float64Value }
+
+func (g *Gauge) Inc()              { g.v.add(1) }
+func (g *Gauge) Dec()              { g.v.add(-1) }
+func (g *Gauge) Add(delta float64) { g.v.add(delta) }
+func (g *Gauge) Set(value float64) { g.v.set(value) }
+func (g *Gauge) Value() float64    { return g.v.get() }
+
+// Histogram 按区间统计观测值
+type Histogram struct {
+	upperBounds []float64
+	counts      []uint64
+	count       uint64
+	sum         float64Value
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{upperBounds: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *Histogram) Observe(value float64) {
+	if i := sort.SearchFloat64s(h.upperBounds, value); i < len(h.upperBounds) {
+		atomic.AddUint64(&h.counts[i], 1)
+	}
+	atomic.AddUint64(&h.count, 1)
+	h.sum.add(value)
+}
+
+// vec 按标签值区分的同一组指标
+type vec struct {
+	labels []string
+	mu     sync.RWMutex
+	series map[string]*series
+	new    func() interface{}
+}
+
+type series struct {
+	values []string
+	metric interface{}
+}
+
+func newVec(labels []string, new func() interface{}) *vec {
+	return &vec{labels: labels, series: make(map[string]*series), new: new}
+}
+
+func (v *vec) with(values []string) interface{} {
+	if len(values) != len(v.labels) {
+		panic("metrics: inconsistent label cardinality")
+	}
+	key := labelKey(values)
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s.metric
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok = v.series[key]; !ok {
+		s = &series{values: append([]string(nil), values...), metric: v.new()}
+		v.series[key] = s
+	}
+	return s.metric
+}
+
+// sorted 按标签值排序,保证输出稳定
+func (v *vec) sorted() []*series {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	s := make([]*series, 0, len(v.series))
+	for _, item := range v.series {
+		s = append(s, item)
+	}
+	sort.Slice(s, func(i, j int) bool { return labelKey(s[i].values) < labelKey(s[j].values) })
+	return s
+}
+
+func labelKey(values []string) string {
+	var key []byte
+	for _, value := range values {
+		key = append(key, value...)
+		key = append(key, 0xff)
+	}
+	return string(key)
+}
+
+type CounterVec struct{ *vec }
+
+// With 返回标签值对应的 Counter,标签值的数量必须与声明时一致
+func (v *CounterVec) With(values ...string) *Counter { return v.with(values).(*Counter) }
+
+type GaugeVec struct{ *vec }
+
+// With 返回标签值对应的 Gauge,标签值的数量必须与声明时一致
+func (v *GaugeVec) With(values ...string) *Gauge { return v.with(values).(*Gauge) }
+
+type HistogramVec struct{ *vec }
+
+// With 返回标签值对应的 Histogram,标签值的数量必须与声明时一致
+func (v *HistogramVec) With(values ...string) *Histogram { return v.with(values).(*Histogram) }
@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	counterType   = "counter"
+	gaugeType     = "gauge"
+	histogramType = "histogram"
+
+	// ContentType Prometheus 文本格式
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+type family struct {
+	name string
+	help string
+	typ  string
+	vec  *vec
+}
+
+// Registry 保存所有指标,实现 http.Handler 以 Prometheus 文本格式输出
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// register 同名的指标只能注册一次
+func (r *Registry) register(name, help, typ string, v *vec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exist := r.families[name]; exist {
+		panic(fmt.Sprintf("metrics: %s already registered", name))
+	}
+	r.families[name] = &family{name: name, help: help, typ: typ, vec: v}
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := newVec(labels, func() interface{} { return new(Counter) })
+	r.register(name, help, counterType, v)
+	return &CounterVec{v}
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := newVec(labels, func() interface{} { return new(Gauge) })
+	r.register(name, help, gaugeType, v)
+	return &GaugeVec{v}
+}
+
+// NewHistogramVec buckets 为空时使用 DefBuckets
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	v := newVec(labels, func() interface{} { return newHistogram(buckets) })
+	r.register(name, help, histogramType, v)
+	return &HistogramVec{v}
+}
+
+// WriteTo 按名称排序输出所有指标
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	var buff bytes.Buffer
+	for _, f := range families {
+		writeFamily(&buff, f)
+	}
+	return buff.WriteTo(w)
+}
+
+func (r *Registry) ServeHTTP(response http.ResponseWriter, _ *http.Request) {
+	response.Header().Set("content-type", ContentType)
+	writer := bufio.NewWriter(response)
+	_, _ = r.WriteTo(writer)
+	_ = writer.Flush()
+}
+
+func writeFamily(buff *bytes.Buffer, f *family) {
+	_, _ = fmt.Fprintf(buff, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	_, _ = fmt.Fprintf(buff, "# TYPE %s %s\n", f.name, f.typ)
+	for _, s := range f.vec.sorted() {
+		switch m := s.metric.(type) {
+		case *Counter:
+			writeSample(buff, f.name, f.vec.labels, s.values, "", "", m.Value())
+		case *Gauge:
+			writeSample(buff, f.name, f.vec.labels, s.values, "", "", m.Value())
+		case *Histogram:
+			var cumulative uint64
+			for i, upperBound := range m.upperBounds {
+				cumulative += atomic.LoadUint64(&m.counts[i])
+				writeSample(buff, f.name+"_bucket", f.vec.labels, s.values, "le", formatFloat(upperBound), float64(cumulative))
+			}
+			count := atomic.LoadUint64(&m.count)
+			writeSample(buff, f.name+"_bucket", f.vec.labels, s.values, "le", "+Inf", float64(count))
+			writeSample(buff, f.name+"_sum", f.vec.labels, s.values, "", "", m.sum.get())
+			writeSample(buff, f.name+"_count", f.vec.labels, s.values, "", "", float64(count))
+		}
+	}
+}
+
+func writeSample(buff *bytes.Buffer, name string, labels, values []string, extraLabel, extraValue string, value float64) {
+	buff.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		buff.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				buff.WriteByte(',')
+			}
+			_, _ = fmt.Fprintf(buff, "%s=\"%s\"", label, escapeLabelValue(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				buff.WriteByte(',')
+			}
+			_, _ = fmt.Fprintf(buff, "%s=\"%s\"", extraLabel, extraValue)
+		}
+		buff.WriteByte('}')
+	}
+	buff.WriteByte(' ')
+	buff.WriteString(formatFloat(value))
+	buff.WriteByte('\n')
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string       { return helpReplacer.Replace(s) }
+func escapeLabelValue(s string) string { return labelReplacer.Replace(s) }
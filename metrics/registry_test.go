@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	registry := NewRegistry()
+	calls := registry.NewCounterVec("calls_total", "Total calls.", "method")
+	pending := registry.NewGaugeVec("pending", "Pending calls.")
+	latency := registry.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "method")
+
+	calls.With("a.b").Inc()
+	calls.With("a.b").Add(2)
+	calls.With(`x"y`).Inc()
+	pending.With().Set(3)
+	pending.With().Dec()
+	latency.With("a.b").Observe(0.05)
+	latency.With("a.b").Observe(0.5)
+	latency.With("a.b").Observe(5)
+
+	var buff bytes.Buffer
+	if _, err := registry.WriteTo(&buff); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP calls_total Total calls.
+# TYPE calls_total counter
+calls_total{method="a.b"} 3
+calls_total{method="x\"y"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="a.b",le="0.1"} 1
+latency_seconds_bucket{method="a.b",le="1"} 2
+latency_seconds_bucket{method="a.b",le="+Inf"} 3
+latency_seconds_sum{method="a.b"} 5.55
+latency_seconds_count{method="a.b"} 3
+# HELP pending Pending calls.
+# TYPE pending gauge
+pending 2
+`
+	if got := buff.String(); got != want {
+		t.Fatalf("unexpected exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -30,6 +30,7 @@ func main() {
 	var err error
 	jsonRpcServer := rpc.NewServer(jsonrpc.NewServerCodec)
 	jsonRpcServer.Logger = logger
+	jsonRpcServer.MediaType = jsonrpc.ContentType
 	if err = jsonRpcServer.Register("rpc", new(service)); err != nil {
 		panic(err)
 	}
@@ -64,7 +65,7 @@ func call12() {
 	var result1 int
 	var result2 int
 
-	err := client.Bath(context.Background(), rpc.BatchElem{
+	err := client.Batch(context.Background(), rpc.BatchElem{
 		Method: "rpc.subtract",
 		Params: []interface{}{42, 23},
 		Result: &result1,
@@ -213,7 +214,7 @@ func startUnix(jsonRpcServer *rpc.Server) {
 func startHttp(jsonRpcServer *rpc.Server) {
 	go func() {
 		if err := http.ListenAndServe(httpEndpoint, http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
-			jsonrpc.HttpHandlers.ValidHeader.ServeHTTP(response, request)
+			jsonrpc.ValidHeader(jsonRpcServer.ContentTypes()...).ServeHTTP(response, request)
 			jsonRpcServer.ServeHTTP(response, request)
 		})); err != nil {
 			panic(err)
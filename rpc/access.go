@@ -0,0 +1,79 @@
+package rpc
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// accessLog 单次请求(可能是批处理)的访问日志
+type accessLog struct {
+	start   time.Time
+	peer    Peer
+	batch   bool
+	methods []string
+	codes   []int64
+	size    int
+}
+
+func newAccessLog(ctx context.Context) *accessLog {
+	return &accessLog{start: time.Now(), peer: PeerFromContext(ctx)}
+}
+
+func (a *accessLog) request(requests *RequestMessages) {
+	a.batch = requests.Batch
+	for _, request := range requests.Elems {
+		a.methods = append(a.methods, request.Method)
+	}
+}
+
+func (a *accessLog) response(responses *ResponseMessages) {
+	for _, response := range responses.Elems {
+		if response.Error != nil {
+			a.codes = append(a.codes, response.Error.Code)
+		}
+	}
+}
+
+func (s *Server) logAccess(ctx context.Context, a *accessLog) {
+	s.logger(ctx).Info("server.access",
+		zap.String("transport", a.peer.Transport),
+		zap.String("remoteAddr", a.peer.RemoteAddr),
+		zap.Strings("method", a.methods),
+		zap.Bool("batch", a.batch),
+		zap.Duration("duration", time.Since(a.start)),
+		zap.Int64s("code", a.codes),
+		zap.Int("size", a.size),
+	)
+}
+
+// withRequestID 没有请求ID时生成新的ID,并附加包含请求ID的 Logger
+func (s *Server) withRequestID(ctx context.Context) context.Context {
+	id := RequestIDFromContext(ctx)
+	if id == "" {
+		id = newCorrelationID()
+		ctx = context.WithValue(ctx, requestIDContextKey, id)
+	}
+	return context.WithValue(ctx, loggerContextKey, s.Logger.With(zap.String("requestId", id)))
+}
+
+func (s *Server) logger(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(loggerContextKey).(*zap.Logger); ok {
+		return logger
+	}
+	return s.Logger
+}
+
+// validRequestID 限制外部传入的请求ID,避免污染日志
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if c := id[i]; c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
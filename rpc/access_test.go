@@ -0,0 +1,88 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type echoService struct{}
+
+// RequestID 通过 ctx 中的 Logger 记录日志, 返回请求ID
+func (echoService) RequestID(ctx context.Context) string {
+	rpc.LoggerFromContext(ctx).Info("echo.requestId")
+	return rpc.RequestIDFromContext(ctx)
+}
+
+func TestRequestIDAndAccessLog(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	server.Logger = zap.New(core)
+	if err := server.Register("echo", echoService{}); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	post := func(id string) (string, string) {
+		body := `[{"jsonrpc":"2.0","id":1,"method":"echo.requestID"},{"jsonrpc":"2.0","id":2,"method":"echo.missing"}]`
+		request, _ := http.NewRequest(http.MethodPost, httpServer.URL, bytes.NewBufferString(body))
+		request.Header.Set("Content-Type", jsonrpc.ContentType)
+		if id != "" {
+			request.Header.Set(rpc.RequestIDHeader, id)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var buff bytes.Buffer
+		_, _ = buff.ReadFrom(response.Body)
+		return response.Header.Get(rpc.RequestIDHeader), buff.String()
+	}
+
+	// 请求头中的ID原样返回,回调与日志使用相同的ID
+	echoed, body := post("req-1")
+	if echoed != "req-1" || !bytes.Contains([]byte(body), []byte(`"result":"req-1"`)) {
+		t.Fatalf("want req-1, got header %q body %s", echoed, body)
+	}
+	if n := logs.FilterMessage("echo.requestId").FilterField(zap.String("requestId", "req-1")).Len(); n != 1 {
+		t.Fatalf("callback log with requestId: %d", n)
+	}
+	access := logs.FilterMessage("server.access").FilterField(zap.String("requestId", "req-1")).All()
+	if len(access) != 1 {
+		t.Fatalf("access logs: %d", len(access))
+	}
+	fields := access[0].ContextMap()
+	if fields["transport"] != "http" || fields["batch"] != true || fields["remoteAddr"] == "" {
+		t.Fatalf("unexpected access log %v", fields)
+	}
+	if methods, ok := fields["method"].([]interface{}); !ok || len(methods) != 2 || methods[0] != "echo.requestID" {
+		t.Fatalf("unexpected methods %v", fields["method"])
+	}
+	if codes, ok := fields["code"].([]interface{}); !ok || len(codes) != 1 || codes[0] != int64(-32601) {
+		t.Fatalf("unexpected codes %v", fields["code"])
+	}
+	if size, ok := fields["size"].(int64); !ok || size != int64(len(body)) {
+		t.Fatalf("want size %d, got %v", len(body), fields["size"])
+	}
+	if _, ok := fields["duration"]; !ok {
+		t.Fatalf("missing duration %v", fields)
+	}
+
+	// 没有请求头或者请求头无效时生成新的ID
+	for _, id := range []string{"", "bad id"} {
+		generated, body := post(id)
+		if generated == "" || generated == id || !bytes.Contains([]byte(body), []byte(`"result":"`+generated+`"`)) {
+			t.Fatalf("want generated id, got header %q body %s", generated, body)
+		}
+	}
+}
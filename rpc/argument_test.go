@@ -0,0 +1,44 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+func TestArgumentError(t *testing.T) {
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("math", mathService{}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(context.Background(), server, jsonrpc.NewClientCodec)
+	defer client.Close()
+
+	tests := []struct {
+		args []interface{}
+		want rpc.ArgumentError
+	}{
+		{[]interface{}{1}, rpc.ArgumentError{Index: 1, GoType: "int", JSONType: "number", Reason: "missing value for required argument"}},
+		{[]interface{}{1, 2, 3}, rpc.ArgumentError{Index: 2, Reason: "too many arguments, want at most 2"}},
+		{[]interface{}{1, "2"}, rpc.ArgumentError{Index: 1, GoType: "int", JSONType: "number"}},
+	}
+	for _, test := range tests {
+		err := client.Call(context.Background(), "math.add", nil, test.args...)
+		me, ok := err.(*rpc.MessageError)
+		if !ok || me.Code != -32602 {
+			t.Fatalf("%v: want invalid params, got %v", test.args, err)
+		}
+		var got rpc.ArgumentError
+		raw, _ := json.Marshal(me.Data)
+		if err = json.Unmarshal(raw, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Reason == "" || got.Index != test.want.Index || got.GoType != test.want.GoType || got.JSONType != test.want.JSONType ||
+			(test.want.Reason != "" && got.Reason != test.want.Reason) {
+			t.Fatalf("%v: want %+v, got %+v (%s)", test.args, test.want, got, me.Message)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/smallsung/gopkg/errors"
+	"go.uber.org/zap"
+)
+
+// healthCheckMethod 内置的 rpc.modules 不依赖任何服务,可以用来判断节点是否可用
+const healthCheckMethod = builtinServiceName + MethodSeparator + "modules"
+
+// Endpoint Balancer 中的一个节点
+type Endpoint struct {
+	Name   string
+	Client *Client
+
+	unhealthy int32
+}
+
+// Healthy 最近一次调用或者健康检查没有发生传输错误
+func (e *Endpoint) Healthy() bool {
+	return atomic.LoadInt32(&e.unhealthy) == 0
+}
+
+// setHealthy 状态发生变化时返回 true
+func (e *Endpoint) setHealthy(healthy bool) bool {
+	if healthy {
+		return atomic.SwapInt32(&e.unhealthy, 0) != 0
+	}
+	return atomic.SwapInt32(&e.unhealthy, 1) == 0
+}
+
+// BalanceStrategy 从 endpoints 中选择一个节点, endpoints 不为空
+type BalanceStrategy interface {
+	Pick(endpoints []*Endpoint) *Endpoint
+}
+
+// RoundRobin 依次选择节点
+type RoundRobin struct {
+	next uint64
+}
+
+func (r *RoundRobin) Pick(endpoints []*Endpoint) *Endpoint {
+	n := atomic.AddUint64(&r.next, 1) - 1
+	return endpoints[n%uint64(len(endpoints))]
+}
+
+// LeastPending 选择等待响应的调用最少的节点
+type LeastPending struct{}
+
+func (LeastPending) Pick(endpoints []*Endpoint) *Endpoint {
+	picked := endpoints[0]
+	for _, e := range endpoints[1:] {
+		if e.Client.Pending() < picked.Client.Pending() {
+			picked = e
+		}
+	}
+	return picked
+}
+
+// Balancer 把调用分配到多个提供相同服务的节点.
+// 发生传输错误的节点被标记为不可用,直到健康检查成功. 所有节点都不可用时仍然尝试所有节点
+type Balancer struct {
+	Logger *zap.Logger
+	// Strategy 为 nil 时使用 RoundRobin
+	Strategy BalanceStrategy
+	// Idempotent 返回 true 的方法发生传输错误时换一个节点重试,每个节点最多尝试一次.
+	// 通过 WithIdempotent 标记的调用同样会重试
+	Idempotent func(method string) bool
+	// HealthCheckTimeout 单个节点健康检查的超时时间,为 0 时使用 ctx 的超时时间
+	HealthCheckTimeout time.Duration
+
+	roundRobin RoundRobin
+
+	mu        sync.RWMutex
+	endpoints []*Endpoint
+}
+
+func NewBalancer(endpoints ...*Endpoint) *Balancer {
+	return &Balancer{
+		Logger:    zap.NewNop(),
+		endpoints: endpoints,
+	}
+}
+
+// Add 添加节点
+func (b *Balancer) Add(endpoint *Endpoint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.endpoints = append(b.endpoints, endpoint)
+}
+
+// Remove 移除并返回名称为 name 的节点, 不会关闭节点的 Client
+func (b *Balancer) Remove(name string) *Endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, e := range b.endpoints {
+		if e.Name == name {
+			b.endpoints = append(b.endpoints[:i:i], b.endpoints[i+1:]...)
+			return e
+		}
+	}
+	return nil
+}
+
+// Endpoints 返回所有节点
+func (b *Balancer) Endpoints() []*Endpoint {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]*Endpoint(nil), b.endpoints...)
+}
+
+// pick 从没有尝试过的节点中选择. 没有可用的节点时忽略健康状态
+func (b *Balancer) pick(tried map[*Endpoint]bool) *Endpoint {
+	var healthy, untried []*Endpoint
+	for _, e := range b.Endpoints() {
+		if tried[e] {
+			continue
+		}
+		untried = append(untried, e)
+		if e.Healthy() {
+			healthy = append(healthy, e)
+		}
+	}
+	candidates := healthy
+	if len(candidates) == 0 {
+		candidates = untried
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	if b.Strategy == nil {
+		return b.roundRobin.Pick(candidates)
+	}
+	return b.Strategy.Pick(candidates)
+}
+
+func (b *Balancer) setHealthy(e *Endpoint, err error) {
+	if !e.setHealthy(err == nil) {
+		return
+	}
+	if err == nil {
+		b.Logger.Info("balancer.healthy", zap.String("endpoint", e.Name))
+	} else {
+		b.Logger.Warn("balancer.unhealthy", zap.String("endpoint", e.Name), zap.Error(err))
+	}
+}
+
+// Call 调用 method. 可重试的方法发生传输错误时在其他节点上重试
+func (b *Balancer) Call(ctx context.Context, method MessageMethod, result interface{}, params ...interface{}) error {
+	tried := make(map[*Endpoint]bool)
+	err := ErrNoEndpoint
+	for {
+		e := b.pick(tried)
+		if e == nil {
+			return err
+		}
+		tried[e] = true
+		err = e.Client.Call(ctx, method, result, params...)
+		// 熔断的调用没有发送,总是可以换一个节点
+		var coe *CircuitOpenError
+		if errors.As(err, &coe) {
+			continue
+		}
+		if !IsTransportError(err) {
+			// 节点返回了响应(包括服务端的错误), ctx 结束不说明节点的状态
+			if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+				b.setHealthy(e, nil)
+			}
+			return err
+		}
+		b.setHealthy(e, err)
+		if !(isIdempotent(ctx) || b.Idempotent != nil && b.Idempotent(method)) || ctx.Err() != nil {
+			return err
+		}
+		b.Logger.Debug("balancer.failover", zap.String("endpoint", e.Name), zap.String("method", method), zap.Error(err))
+	}
+}
+
+// Notice 发送通知, 不重试
+func (b *Balancer) Notice(ctx context.Context, method string, params ...interface{}) error {
+	e := b.pick(nil)
+	if e == nil {
+		return ErrNoEndpoint
+	}
+	err := e.Client.Notice(ctx, method, params...)
+	if IsTransportError(err) {
+		b.setHealthy(e, err)
+	}
+	return err
+}
+
+// CheckHealth 对所有节点调用 rpc.modules, 更新节点的健康状态
+func (b *Balancer) CheckHealth(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for _, e := range b.Endpoints() {
+		wg.Add(1)
+		go func(e *Endpoint) {
+			defer wg.Done()
+			checkCtx := ctx
+			if b.HealthCheckTimeout > 0 {
+				var cancel context.CancelFunc
+				checkCtx, cancel = context.WithTimeout(ctx, b.HealthCheckTimeout)
+				defer cancel()
+			}
+			err := e.Client.Call(checkCtx, healthCheckMethod, nil)
+			if ctx.Err() != nil {
+				return
+			}
+			// 服务端返回的错误也说明节点可以响应
+			if !IsTransportError(err) && checkCtx.Err() == nil {
+				err = nil
+			}
+			b.setHealthy(e, err)
+		}(e)
+	}
+	wg.Wait()
+}
+
+// HealthCheck 每隔 interval 执行一次 CheckHealth, 直到 ctx 结束
+func (b *Balancer) HealthCheck(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		b.CheckHealth(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close 关闭所有节点的 Client
+func (b *Balancer) Close() {
+	for _, e := range b.Endpoints() {
+		e.Client.Close()
+	}
+}
@@ -0,0 +1,118 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+type replicaService struct {
+	hits *int64
+}
+
+func (s replicaService) Hit() int64 { return atomic.AddInt64(s.hits, 1) }
+
+func TestBalancer(t *testing.T) {
+	ctx := context.Background()
+	hits := make([]int64, 3)
+	var endpoints []*rpc.Endpoint
+	for i := range hits {
+		server := rpc.NewServer(jsonrpc.NewServerCodec)
+		if err := server.Register("replica", replicaService{&hits[i]}); err != nil {
+			t.Fatal(err)
+		}
+		endpoints = append(endpoints, &rpc.Endpoint{Name: string(rune('a' + i)), Client: rpc.DialInProc(ctx, server, jsonrpc.NewClientCodec)})
+	}
+	balancer := rpc.NewBalancer(endpoints...)
+	defer balancer.Close()
+
+	for i := 0; i < 6; i++ {
+		if err := balancer.Call(ctx, "replica.hit", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, n := range hits {
+		if n != 2 {
+			t.Fatalf("endpoint %d: want 2 hits, got %d", i, n)
+		}
+	}
+
+	// 节点 b 断开后, 不可重试的调用返回传输错误, 可重试的调用转移到其他节点
+	endpoints[1].Client.Close()
+	var failed int
+	for i := 0; i < 3; i++ {
+		if err := balancer.Call(ctx, "replica.hit", nil); err != nil {
+			if !rpc.IsTransportError(err) {
+				t.Fatal(err)
+			}
+			failed++
+		}
+	}
+	if failed != 1 || endpoints[1].Healthy() {
+		t.Fatalf("failed %d, b healthy %v", failed, endpoints[1].Healthy())
+	}
+
+	balancer.Idempotent = func(method string) bool { return method == "replica.hit" }
+	endpoints[0].Client.Close()
+	balancer.CheckHealth(ctx)
+	if endpoints[0].Healthy() || endpoints[1].Healthy() || !endpoints[2].Healthy() {
+		t.Fatal("health check didn't mark closed endpoints")
+	}
+	before := atomic.LoadInt64(&hits[2])
+	for i := 0; i < 3; i++ {
+		if err := balancer.Call(ctx, "replica.hit", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if atomic.LoadInt64(&hits[2]) != before+3 {
+		t.Fatal("calls weren't routed to the healthy endpoint")
+	}
+
+	// 所有节点都不可用时尝试所有节点, 可重试的调用最终返回传输错误
+	endpoints[2].Client.Close()
+	if err := balancer.Call(ctx, "replica.hit", nil); !rpc.IsTransportError(err) {
+		t.Fatalf("want transport error, got %v", err)
+	}
+}
+
+func TestBalancerMarksHealthyOnResponse(t *testing.T) {
+	ctx := context.Background()
+	var hits int64
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("replica", replicaService{&hits}); err != nil {
+		t.Fatal(err)
+	}
+	// 第一个请求返回 503
+	var requests int64
+	httpServer := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if atomic.AddInt64(&requests, 1) == 1 {
+			http.Error(response, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		server.ServeHTTP(response, request)
+	}))
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+
+	endpoint := &rpc.Endpoint{Name: "a", Client: rpc.DialHTTP(ctx, URL, jsonrpc.NewClientCodec)}
+	balancer := rpc.NewBalancer(endpoint)
+	if err := balancer.Call(ctx, "replica.hit", nil); !rpc.IsTransportError(err) {
+		t.Fatalf("want transport error, got %v", err)
+	}
+	if endpoint.Healthy() {
+		t.Fatal("endpoint should be unhealthy after a transport error")
+	}
+	// 服务端返回的错误同样说明节点可以响应
+	if err := balancer.Call(ctx, "replica.missing", nil); err == nil || rpc.IsTransportError(err) {
+		t.Fatalf("want method not found, got %v", err)
+	}
+	if !endpoint.Healthy() {
+		t.Fatal("endpoint should be healthy after it responded")
+	}
+}
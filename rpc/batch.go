@@ -0,0 +1,128 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/smallsung/gopkg/errors"
+)
+
+// handleResponse 记录批量响应中的一个响应
+func (elem *BatchElem) handleResponse(codec ClientCodec, response *ResponseMessage) {
+	elem.done = true
+	switch {
+	case response.Error != nil:
+		elem.Error = decodeError(codec, response.Error)
+	case elem.Result == nil:
+		elem.raw = response.Result
+	default:
+		if err := codec.UnmarshalResponseResult(response.Result, elem.Result); err != nil {
+			elem.Error = &ResultError{errors.Annotate(err, "codec.UnmarshalResponseResult")}
+		}
+	}
+}
+
+// BatchBuilder 逐个添加调用, 在一个批量请求中发送. 每个调用的结果通过 Add 返回的 BatchFuture 获取.
+// BatchBuilder 只能发送一次, 发送之后添加与发送都返回 ErrBatchSent
+type BatchBuilder struct {
+	client *Client
+	elems  []BatchElem
+	call   *Call
+	done   chan struct{}
+}
+
+// NewBatch 返回一个空的 BatchBuilder
+func (c *Client) NewBatch() *BatchBuilder {
+	return &BatchBuilder{client: c, done: make(chan struct{})}
+}
+
+// Add 添加一个调用,返回这个调用的 BatchFuture. 批量请求已经发送时调用不会被添加, BatchFuture 返回 ErrBatchSent
+func (b *BatchBuilder) Add(method MessageMethod, params ...interface{}) *BatchFuture {
+	if b.call != nil {
+		done := make(chan struct{})
+		close(done)
+		return &BatchFuture{batch: b, index: -1, done: done, err: ErrBatchSent}
+	}
+	b.elems = append(b.elems, BatchElem{Method: method, Params: params})
+	return &BatchFuture{batch: b, index: len(b.elems) - 1, done: b.done}
+}
+
+// Len 返回已经添加的调用数量
+func (b *BatchBuilder) Len() int {
+	return len(b.elems)
+}
+
+// SendAsync 发送批量请求,不等待响应. 已经发送过时返回 ErrBatchSent
+func (b *BatchBuilder) SendAsync(ctx context.Context) error {
+	if b.call != nil {
+		return ErrBatchSent
+	}
+	b.call = b.client.BatchAsync(ctx, make(chan *Call, 1), b.elems...)
+	go func() {
+		<-b.call.Done
+		close(b.done)
+	}()
+	return nil
+}
+
+// Wait 等待所有响应, 返回整个批量调用的错误, 比如传输错误, ctx 结束. 每个调用的错误通过 BatchFuture 获取.
+// 还没有调用 SendAsync 时返回 ErrBatchNotSent
+func (b *BatchBuilder) Wait() error {
+	if b.call == nil {
+		return ErrBatchNotSent
+	}
+	<-b.done
+	return b.call.Error
+}
+
+// Send 发送批量请求并等待所有响应, 与 SendAsync, Wait 相同
+func (b *BatchBuilder) Send(ctx context.Context) error {
+	if err := b.SendAsync(ctx); err != nil {
+		return err
+	}
+	return b.Wait()
+}
+
+// BatchFuture 批量请求中一个调用的结果
+type BatchFuture struct {
+	batch *BatchBuilder
+	index int
+	done  chan struct{}
+	// err 调用没有被添加到批量请求中
+	err error
+}
+
+// Done 在批量请求结束后关闭
+func (f *BatchFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err 等待批量请求结束,返回这个调用的错误. 调用没有收到响应时返回整个批量调用的错误或者 ErrMissingResponse
+func (f *BatchFuture) Err() error {
+	if f.err != nil {
+		return f.err
+	}
+	<-f.done
+	elem := &f.batch.elems[f.index]
+	if elem.Error == nil && !elem.done {
+		if f.batch.call.Error != nil {
+			return f.batch.call.Error
+		}
+		return ErrMissingResponse
+	}
+	return elem.Error
+}
+
+// Decode 等待批量请求结束, 将这个调用的结果解码到 v. 响应中没有结果时不修改 v
+func (f *BatchFuture) Decode(v interface{}) error {
+	if err := f.Err(); err != nil {
+		return err
+	}
+	raw := f.batch.elems[f.index].raw
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := f.batch.client.codec.UnmarshalResponseResult(raw, v); err != nil {
+		return &ResultError{errors.Annotate(err, "codec.UnmarshalResponseResult")}
+	}
+	return nil
+}
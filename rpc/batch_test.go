@@ -0,0 +1,202 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+func TestBatchBuilder(t *testing.T) {
+	ctx := context.Background()
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("math", mathService{}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(ctx, server, jsonrpc.NewClientCodec)
+	defer client.Close()
+
+	batch := client.NewBatch()
+	if err := batch.Wait(); !errors.Is(err, rpc.ErrBatchNotSent) {
+		t.Fatalf("want ErrBatchNotSent, got %v", err)
+	}
+	// 发送失败时 Wait 同样返回
+	empty := client.NewBatch()
+	if err := empty.SendAsync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := empty.Wait(); !errors.Is(err, rpc.ErrInvalidParams) {
+		t.Fatalf("want ErrInvalidParams, got %v", err)
+	}
+
+	sum := batch.Add("math.add", 1, 2)
+	missing := batch.Add("math.missing")
+	wrongType := batch.Add("math.add", 3, 4)
+	if err := batch.Send(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := sum.Decode(&n); err != nil || n != 3 {
+		t.Fatalf("want 3, got %d %v", n, err)
+	}
+	if err := missing.Err(); err == nil || rpc.IsTransportError(err) {
+		t.Fatalf("want method not found, got %v", err)
+	}
+	var s string
+	var re *rpc.ResultError
+	if err := wrongType.Decode(&s); !errors.As(err, &re) {
+		t.Fatalf("want ResultError, got %v", err)
+	}
+
+	// 已经发送的批量请求不能再添加或者发送
+	if err := batch.Send(ctx); !errors.Is(err, rpc.ErrBatchSent) {
+		t.Fatalf("want ErrBatchSent, got %v", err)
+	}
+	late := batch.Add("math.add", 5, 6)
+	<-late.Done()
+	if err := late.Decode(&n); !errors.Is(err, rpc.ErrBatchSent) || batch.Len() != 3 {
+		t.Fatalf("want ErrBatchSent, got %v with %d calls", err, batch.Len())
+	}
+
+	// 调用的错误不是整个批量调用的错误
+	elems := []rpc.BatchElem{{Method: "math.add", Params: []interface{}{1, 2}, Result: &n}, {Method: "math.missing"}}
+	if err := client.Batch(ctx, elems...); err != nil {
+		t.Fatal(err)
+	}
+	if elems[0].Error != nil || elems[1].Error == nil {
+		t.Fatalf("unexpected batch results %v", elems)
+	}
+	if err := client.Bath(ctx, elems...); err == nil {
+		t.Fatal("Bath: want error from math.missing")
+	}
+
+	client.Close()
+	closed := client.NewBatch()
+	future := closed.Add("math.add", 1, 2)
+	if err := closed.Send(ctx); !errors.Is(err, rpc.ErrClientClosed) {
+		t.Fatalf("want ErrClientClosed, got %v", err)
+	}
+	if err := future.Err(); !errors.Is(err, rpc.ErrClientClosed) {
+		t.Fatalf("want ErrClientClosed, got %v", err)
+	}
+}
+
+// firstResponseOnly 只响应批量请求中的第一个调用
+func firstResponseOnly(request json.RawMessage) []byte {
+	var requests []struct{ ID json.RawMessage }
+	_ = json.Unmarshal(request, &requests)
+	return []byte(fmt.Sprintf(`[{"jsonrpc":"2.0","id":%s,"result":1}]`, requests[0].ID))
+}
+
+func TestBatchMissingResponse(t *testing.T) {
+	ctx := context.Background()
+
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request json.RawMessage
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		_, _ = w.Write(firstResponseOnly(request))
+	}))
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+
+	serverConn, clientConn := net.Pipe()
+	go func() {
+		var request json.RawMessage
+		if err := json.NewDecoder(serverConn).Decode(&request); err == nil {
+			_, _ = serverConn.Write(firstResponseOnly(request))
+		}
+	}()
+	defer serverConn.Close()
+
+	clients := []*rpc.Client{
+		rpc.DialHTTP(ctx, URL, jsonrpc.NewClientCodec),
+		rpc.NewClient(jsonrpc.NewClientCodec(clientConn)),
+	}
+	for _, client := range clients {
+		batch := client.NewBatch()
+		first := batch.Add("math.add", 1, 2)
+		second := batch.Add("math.add", 3, 4)
+		if err := batch.Send(ctx); err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		if err := first.Decode(&n); err != nil || n != 1 {
+			t.Fatalf("want 1, got %d %v", n, err)
+		}
+		if err := second.Err(); !errors.Is(err, rpc.ErrMissingResponse) {
+			t.Fatalf("want ErrMissingResponse, got %v", err)
+		}
+		client.Close()
+	}
+}
+
+func TestBatchEmptyResult(t *testing.T) {
+	ctx := context.Background()
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var requests []struct{ ID json.RawMessage }
+		_ = json.NewDecoder(r.Body).Decode(&requests)
+		_, _ = fmt.Fprintf(w, `[{"jsonrpc":"2.0","id":%s}]`, requests[0].ID)
+	}))
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+	client := rpc.DialHTTP(ctx, URL, jsonrpc.NewClientCodec)
+	defer client.Close()
+
+	batch := client.NewBatch()
+	future := batch.Add("notice.record", "a")
+	if err := batch.Send(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 没有结果时不修改 v
+	s := "keep"
+	if err := future.Decode(&s); err != nil || s != "keep" {
+		t.Fatalf("want unchanged value, got %q %v", s, err)
+	}
+}
+
+// 服务端对单个调用返回空的批量响应
+func TestHTTPEmptyResponse(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+	client := rpc.DialHTTP(context.Background(), URL, jsonrpc.NewClientCodec)
+	defer client.Close()
+
+	var n int
+	if err := client.Call(context.Background(), "math.add", &n, 1, 2); !errors.Is(err, rpc.ErrMissingResponse) {
+		t.Fatalf("want ErrMissingResponse, got %v", err)
+	}
+}
+
+// Bath 保持旧的语义: HTTP 上调用的错误不作为整个批量调用的错误
+func TestBathHTTP(t *testing.T) {
+	ctx := context.Background()
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("math", mathService{}); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+	client := rpc.DialHTTP(ctx, URL, jsonrpc.NewClientCodec)
+	defer client.Close()
+
+	var n int
+	elems := []rpc.BatchElem{{Method: "math.add", Params: []interface{}{1, 2}, Result: &n}, {Method: "math.missing"}}
+	if err := client.Bath(ctx, elems...); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || elems[1].Error == nil {
+		t.Fatalf("unexpected batch results %v", elems)
+	}
+}
@@ -0,0 +1,256 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/smallsung/gopkg/errors"
+)
+
+type CircuitState int32
+
+const (
+	// CircuitClosed 正常调用
+	CircuitClosed CircuitState = iota
+	// CircuitOpen 调用直接返回 CircuitOpenError
+	CircuitOpen
+	// CircuitHalfOpen 允许少量试探调用,成功后关闭,失败后重新打开
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int32(s))
+	}
+}
+
+// CircuitOpenError 熔断器打开,调用没有发送. Method 为空表示整个节点熔断
+type CircuitOpenError struct {
+	Method string
+	// RetryAfter 之后进入半开状态
+	RetryAfter time.Time
+}
+
+func (err *CircuitOpenError) Error() string {
+	if err.Method == "" {
+		return "circuit open"
+	}
+	return "circuit open: " + err.Method
+}
+
+// CircuitBreaker Client.Call 的熔断器. 节点(整个 Client)与每个方法分别维护状态, 任意一个打开时调用直接失败
+type CircuitBreaker struct {
+	// FailureThreshold 连续失败的次数达到后打开,为 0 时使用 5
+	FailureThreshold int
+	// OpenTimeout 打开之后经过这段时间进入半开状态,为 0 时使用 30s
+	OpenTimeout time.Duration
+	// HalfOpenRequests 半开状态同时允许的试探调用数量,为 0 时使用 1
+	HalfOpenRequests int
+	// PerMethod 为 false 时只维护节点的状态
+	PerMethod bool
+	// IsFailure 判断调用的错误是否计为失败. 为 nil 时传输错误与超时计为失败
+	IsFailure func(err error) bool
+	// OnStateChange 状态变化时调用, method 为空表示节点的状态
+	OnStateChange func(method string, from, to CircuitState)
+
+	mu       sync.Mutex
+	endpoint circuit
+	methods  map[string]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	// trials 正在进行的试探调用
+	trials int
+}
+
+type stateChange struct {
+	method   string
+	from, to CircuitState
+}
+
+func (b *CircuitBreaker) failureThreshold() int {
+	if b.FailureThreshold == 0 {
+		return 5
+	}
+	return b.FailureThreshold
+}
+
+func (b *CircuitBreaker) openTimeout() time.Duration {
+	if b.OpenTimeout == 0 {
+		return 30 * time.Second
+	}
+	return b.OpenTimeout
+}
+
+func (b *CircuitBreaker) halfOpenRequests() int {
+	if b.HalfOpenRequests == 0 {
+		return 1
+	}
+	return b.HalfOpenRequests
+}
+
+func (b *CircuitBreaker) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if b.IsFailure != nil {
+		return b.IsFailure(err)
+	}
+	return IsTransportError(err) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// State 返回 method 的状态, method 为空时返回节点的状态
+func (b *CircuitBreaker) State(method string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(method, false)
+	if c == nil {
+		return CircuitClosed
+	}
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= b.openTimeout() {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// circuit 在 b.mu 中调用
+func (b *CircuitBreaker) circuit(method string, create bool) *circuit {
+	if method == "" {
+		return &b.endpoint
+	}
+	if !b.PerMethod {
+		return nil
+	}
+	c := b.methods[method]
+	if c == nil && create {
+		if b.methods == nil {
+			b.methods = make(map[string]*circuit)
+		}
+		c = new(circuit)
+		b.methods[method] = c
+	}
+	return c
+}
+
+// methodCircuit 在 b.mu 中调用. method 为空时没有方法的状态, 调用只计入节点
+func (b *CircuitBreaker) methodCircuit(method string, create bool) *circuit {
+	if method == "" {
+		return nil
+	}
+	return b.circuit(method, create)
+}
+
+// wrap 检查熔断器之后调用 call 并记录结果
+func (b *CircuitBreaker) wrap(method string, call func() error) func() error {
+	return func() error {
+		trials, err := b.acquire(method)
+		if err != nil {
+			return err
+		}
+		err = call()
+		b.record(method, trials, err)
+		return err
+	}
+}
+
+// acquire 检查节点与方法的状态. trials 表示调用是否占用了对应的试探名额
+func (b *CircuitBreaker) acquire(method string) (trials [2]bool, err error) {
+	b.mu.Lock()
+	now := time.Now()
+	names := [2]string{"", method}
+	circuits := [2]*circuit{&b.endpoint, b.methodCircuit(method, false)}
+	for i, c := range circuits {
+		if c == nil {
+			continue
+		}
+		switch {
+		case c.state == CircuitOpen && now.Sub(c.openedAt) < b.openTimeout():
+			b.mu.Unlock()
+			return trials, &CircuitOpenError{Method: names[i], RetryAfter: c.openedAt.Add(b.openTimeout())}
+		case c.state != CircuitClosed && c.trials >= b.halfOpenRequests():
+			b.mu.Unlock()
+			return trials, &CircuitOpenError{Method: names[i], RetryAfter: now}
+		}
+	}
+	var changes []stateChange
+	for i, c := range circuits {
+		if c == nil || c.state == CircuitClosed {
+			continue
+		}
+		if c.state == CircuitOpen {
+			changes = append(changes, stateChange{names[i], CircuitOpen, CircuitHalfOpen})
+			c.state = CircuitHalfOpen
+		}
+		c.trials++
+		trials[i] = true
+	}
+	b.mu.Unlock()
+	b.notify(changes)
+	return trials, nil
+}
+
+func (b *CircuitBreaker) record(method string, trials [2]bool, err error) {
+	failure := b.isFailure(err)
+	b.mu.Lock()
+	names := [2]string{"", method}
+	// 方法第一次失败时才创建状态
+	circuits := [2]*circuit{&b.endpoint, b.methodCircuit(method, failure)}
+	var changes []stateChange
+	for i, c := range circuits {
+		if c == nil {
+			continue
+		}
+		from := c.state
+		switch {
+		case trials[i]:
+			c.trials--
+			if c.state != CircuitHalfOpen {
+				break
+			}
+			if failure {
+				c.state, c.openedAt = CircuitOpen, time.Now()
+			} else {
+				c.state = CircuitClosed
+			}
+			c.failures = 0
+		case c.state != CircuitClosed:
+			// 打开之前发出的调用不影响状态
+		case !failure:
+			c.failures = 0
+		default:
+			if c.failures++; c.failures >= b.failureThreshold() {
+				c.state, c.openedAt, c.failures = CircuitOpen, time.Now(), 0
+			}
+		}
+		if c.state != from {
+			changes = append(changes, stateChange{names[i], from, c.state})
+		}
+		// 恢复正常的方法不再保留状态,避免 methods 随方法名无限增长
+		if i == 1 && c.state == CircuitClosed && c.failures == 0 && c.trials == 0 {
+			delete(b.methods, method)
+		}
+	}
+	b.mu.Unlock()
+	b.notify(changes)
+}
+
+func (b *CircuitBreaker) notify(changes []stateChange) {
+	if b.OnStateChange == nil {
+		return
+	}
+	for _, change := range changes {
+		b.OnStateChange(change.method, change.from, change.to)
+	}
+}
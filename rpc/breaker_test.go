@@ -0,0 +1,155 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smallsung/gopkg/errors"
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var requests int64
+	var down int32 = 1
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("math", mathService{}); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		server.ServeHTTP(w, r)
+	}))
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+	client := rpc.DialHTTP(context.Background(), URL, jsonrpc.NewClientCodec)
+	var changes []string
+	client.Breaker = &rpc.CircuitBreaker{
+		FailureThreshold: 2,
+		OpenTimeout:      20 * time.Millisecond,
+		PerMethod:        true,
+		OnStateChange: func(method string, from, to rpc.CircuitState) {
+			changes = append(changes, method+":"+from.String()+"->"+to.String())
+		},
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := client.Call(ctx, "math.add", nil, 1, 2); !rpc.IsTransportError(err) {
+			t.Fatalf("want transport error, got %v", err)
+		}
+	}
+	if state := client.Breaker.State(""); state != rpc.CircuitOpen {
+		t.Fatalf("endpoint: want open, got %s", state)
+	}
+	err := client.Call(ctx, "math.add", nil, 1, 2)
+	var coe *rpc.CircuitOpenError
+	if !errors.As(err, &coe) || atomic.LoadInt64(&requests) != 2 {
+		t.Fatalf("want CircuitOpenError without request, got %v after %d requests", err, requests)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if state := client.Breaker.State("math.add"); state != rpc.CircuitHalfOpen {
+		t.Fatalf("method: want half-open, got %s", state)
+	}
+	atomic.StoreInt32(&down, 0)
+	var sum int
+	if err = client.Call(ctx, "math.add", &sum, 1, 2); err != nil || sum != 3 {
+		t.Fatalf("trial call: %d, %v", sum, err)
+	}
+	if client.Breaker.State("") != rpc.CircuitClosed || client.Breaker.State("math.add") != rpc.CircuitClosed {
+		t.Fatal("breaker didn't close after successful trial")
+	}
+	want := []string{
+		":closed->open", "math.add:closed->open",
+		":open->half-open", "math.add:open->half-open",
+		":half-open->closed", "math.add:half-open->closed",
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes: %v", changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("changes: %v, want %v", changes, want)
+		}
+	}
+}
+
+func TestCircuitStatePerMethod(t *testing.T) {
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("math", mathService{}); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+	client := rpc.DialHTTP(context.Background(), URL, jsonrpc.NewClientCodec)
+	if state := client.CircuitState("math.add"); state != rpc.CircuitClosed {
+		t.Fatalf("no breaker: want closed, got %s", state)
+	}
+	client.Breaker = &rpc.CircuitBreaker{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Hour,
+		PerMethod:        true,
+		IsFailure: func(err error) bool {
+			var me *rpc.MessageError
+			return errors.As(err, &me) && me.Code == -32601
+		},
+	}
+	ctx := context.Background()
+
+	// 成功的调用使节点的失败计数归零,方法的失败计数保留
+	var sum int
+	for i := 0; i < 2; i++ {
+		if err := client.Call(ctx, "math.missing", nil); err == nil {
+			t.Fatal("want method not found")
+		}
+		if err := client.Call(ctx, "math.add", &sum, 1, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if state := client.CircuitState("math.missing"); state != rpc.CircuitOpen {
+		t.Fatalf("math.missing: want open, got %s", state)
+	}
+	if client.CircuitState("") != rpc.CircuitClosed || client.CircuitState("math.add") != rpc.CircuitClosed {
+		t.Fatal("only math.missing should be open")
+	}
+	var coe *rpc.CircuitOpenError
+	if err := client.Call(ctx, "math.missing", nil); !errors.As(err, &coe) || coe.Method != "math.missing" {
+		t.Fatalf("want CircuitOpenError, got %v", err)
+	}
+}
+
+// 方法名为空的调用只计入节点一次
+func TestCircuitBreakerEmptyMethod(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+	client := rpc.DialHTTP(context.Background(), URL, jsonrpc.NewClientCodec)
+	client.Breaker = &rpc.CircuitBreaker{FailureThreshold: 2, OpenTimeout: time.Hour, PerMethod: true}
+	ctx := context.Background()
+
+	if err := client.Call(ctx, "", nil); !rpc.IsTransportError(err) {
+		t.Fatalf("want transport error, got %v", err)
+	}
+	if state := client.CircuitState(""); state != rpc.CircuitClosed {
+		t.Fatalf("want closed after one failure, got %s", state)
+	}
+	if err := client.Call(ctx, "", nil); !rpc.IsTransportError(err) {
+		t.Fatalf("want transport error, got %v", err)
+	}
+	if state := client.CircuitState(""); state != rpc.CircuitOpen {
+		t.Fatalf("want open after two failures, got %s", state)
+	}
+}
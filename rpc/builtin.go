@@ -1,25 +1,45 @@
 package rpc
 
+import (
+	"context"
+
+	"github.com/smallsung/gopkg/errors"
+)
+
 const builtinServiceName = "rpc"
 
+// cancelMethod 客户端放弃等待响应时发送的通知
+const cancelMethod = builtinServiceName + MethodSeparator + "cancel"
+
 type builtinService struct {
 	server *Server
 }
 
 func (s builtinService) Modules() []string {
-	var modules []string
-	for namespace, _ := range s.server.registry.services {
-		modules = append(modules, namespace)
-	}
+	modules, _ := s.server.registry.modules()
 	return modules
 }
 
 func (s builtinService) Module(namespace string) []string {
-	methods := make([]string, 0)
-	if service, exist := s.server.registry.services[namespace]; exist {
-		for name, _ := range service.callbacks {
-			methods = append(methods, name)
-		}
+	return s.server.registry.methods(namespace)
+}
+
+// Revision 服务每次变化时递增,客户端可以据此判断 Modules 的结果是否过期
+func (s builtinService) Revision() uint64 {
+	_, revision := s.server.registry.modules()
+	return revision
+}
+
+// Cancel 取消同一个连接上正在执行的调用. id 是被取消的请求的ID, HTTP 请求无效
+func (s builtinService) Cancel(ctx context.Context, id interface{}) error {
+	conn := ConnectionFromContext(ctx)
+	if conn == nil {
+		return nil
+	}
+	raw, err := encodeMessageID(id)
+	if err != nil {
+		return errors.Annotate(err, "encodeMessageID")
 	}
-	return methods
+	conn.cancelCall(raw)
+	return nil
 }
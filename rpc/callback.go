@@ -6,20 +6,44 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/smallsung/gopkg/errors"
-	strings2 "github.com/smallsung/gopkg/strings"
 )
 
 type Ins struct {
 	Position   []reflect.Type
 	Name       map[string]reflect.Type
 	HasContext bool
+	// Variadic 最后一个参数是可变参数, Position 中的类型是切片
+	Variadic bool
+}
+
+// NumFixed 可变参数之前的参数个数
+func (ins Ins) NumFixed() int {
+	if ins.Variadic {
+		return len(ins.Position) - 1
+	}
+	return len(ins.Position)
+}
+
+// ArgumentType 第 i 个位置参数的类型,超出可变参数之前的参数时为可变参数的元素类型. 参数过多时 ok 为 false
+func (ins Ins) ArgumentType(i int) (typ reflect.Type, ok bool) {
+	if i < ins.NumFixed() {
+		return ins.Position[i], true
+	}
+	if ins.Variadic {
+		return ins.Position[len(ins.Position)-1].Elem(), true
+	}
+	return nil, false
 }
 
 type outs struct {
+	// Position 不包含 error
 	Position []reflect.Type
 	ErrPos   int
+	// Stream 唯一的结果是 channel, 它的值以 rpc.stream 通知发送给调用方
+	Stream bool
 }
 
 type callback struct {
@@ -27,6 +51,13 @@ type callback struct {
 	receiver reflect.Value
 	ins      Ins
 	outs     outs
+
+	// deprecated 不为空时每次调用都记录警告日志
+	deprecated string
+	timeout    time.Duration
+	hidden     bool
+	// resultNames 不为空时多个结果编码为对象,否则编码为数组
+	resultNames []string
 }
 
 func (cb *callback) call(ctx context.Context, args []reflect.Value) (interface{}, error) {
@@ -41,13 +72,30 @@ func (cb *callback) call(ctx context.Context, args []reflect.Value) (interface{}
 
 	results := cb.fn.Call(fullArgs)
 
-	if len(results) == 0 {
-		return nil, nil
+	if cb.outs.ErrPos >= 0 {
+		if !results[cb.outs.ErrPos].IsNil() {
+			return nil, results[cb.outs.ErrPos].Interface().(error)
+		}
+		results = results[:cb.outs.ErrPos]
 	}
-	if cb.outs.ErrPos >= 0 && !results[cb.outs.ErrPos].IsNil() {
-		return nil, results[cb.outs.ErrPos].Interface().(error)
+	switch {
+	case len(results) == 0:
+		return nil, nil
+	case len(results) == 1:
+		return results[0].Interface(), nil
+	case cb.resultNames != nil:
+		object := make(map[string]interface{}, len(results))
+		for i, result := range results {
+			object[cb.resultNames[i]] = result.Interface()
+		}
+		return object, nil
+	default:
+		array := make([]interface{}, 0, len(results))
+		for _, result := range results {
+			array = append(array, result.Interface())
+		}
+		return array, nil
 	}
-	return results[0].Interface(), nil
 }
 
 // Is this type exported or a builtin?
@@ -78,7 +126,7 @@ func makeCallback(fn, receiver reflect.Value) *callback {
 
 	// make callback all input
 	numIn := typ.NumIn()
-	ins := Ins{Position: make([]reflect.Type, 0, numIn), HasContext: false}
+	ins := Ins{Position: make([]reflect.Type, 0, numIn), HasContext: false, Variadic: typ.IsVariadic()}
 	for i := 0; i < numIn; i++ {
 		ins.Position = append(ins.Position, typ.In(i))
 	}
@@ -96,50 +144,82 @@ func makeCallback(fn, receiver reflect.Value) *callback {
 		}
 	}
 
-	// make callback all output
+	// make callback all output. error 只能是最后一个结果
 	numOut := typ.NumOut()
 	outs := outs{Position: make([]reflect.Type, 0, numOut), ErrPos: -1}
-	if numOut > 2 {
-		return nil
-	}
 	for i := 0; i < numOut; i++ {
-		outs.Position = append(outs.Position, typ.Out(i))
-		if !isExportedOrBuiltinType(outs.Position[i]) {
+		out := typ.Out(i)
+		if !isExportedOrBuiltinType(out) {
 			return nil
 		}
-		if isErrorType(outs.Position[i]) {
+		if isErrorType(out) {
+			if i != numOut-1 {
+				return nil
+			}
 			outs.ErrPos = i
+			continue
 		}
+		outs.Position = append(outs.Position, out)
 	}
-	if numOut == 2 && (outs.ErrPos != 1 || isErrorType(outs.Position[0])) {
-		return nil
+	for _, out := range outs.Position {
+		if out.Kind() != reflect.Chan {
+			continue
+		}
+		if len(outs.Position) != 1 || out.ChanDir()&reflect.RecvDir == 0 || !isExportedOrBuiltinType(out.Elem()) {
+			return nil
+		}
+		outs.Stream = true
 	}
 
 	cb.fn, cb.ins, cb.outs = fn, ins, outs
 	return cb
 }
 
-func suitableCallbacks(receiver reflect.Value) (map[string]*callback, error) {
-	cbs := suitableMethods(receiver)
+func suitableCallbacks(receiver reflect.Value, naming NamingPolicy) (map[string]*callback, error) {
+	cbs, err := suitableMethods(receiver, naming)
+	if err != nil {
+		return nil, err
+	}
 	if receiver.Kind() != reflect.Func {
 		return cbs, nil
 	}
 
 	// self
-	if name := runtime.FuncForPC(receiver.Pointer()).Name(); name != "" {
-		if names := strings.Split(name, "."); len(names) == 2 {
-			name = strings2.LowerFirst(names[1])
-			if _, exist := cbs[name]; exist {
-				return nil, errors.Trace(ErrCallbackNameExist)
-			}
-			cbs[name] = cbs["func"]
-			delete(cbs, "func")
-		}
+	name := funcName(receiver)
+	if name == "" {
+		return nil, errors.Format("%s name can't be resolved, use RegisterFunc", receiver.Type().String())
+	}
+	cb := makeCallback(receiver, reflect.Value{})
+	if cb == nil {
+		return cbs, nil
 	}
+	name = naming(name)
+	if _, exist := cbs[name]; exist {
+		return nil, errors.Annotate(ErrCallbackNameExist, name)
+	}
+	cbs[name] = cb
 	return cbs, nil
 }
 
-func suitableMethods(receiver reflect.Value) map[string]*callback {
+// funcName 从 runtime 的函数名 "path/to/pkg.Name" 中取出 Name. 闭包 "pkg.Name.func1" 与方法值 "pkg.T.Name-fm" 返回空
+func funcName(fn reflect.Value) string {
+	f := runtime.FuncForPC(fn.Pointer())
+	if f == nil {
+		return ""
+	}
+	name := f.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	names := strings.Split(name, ".")
+	if len(names) != 2 || !token.IsIdentifier(names[1]) {
+		return ""
+	}
+	return names[1]
+}
+
+// suitableMethods 不同的 Go 方法名可能被 naming 转换为相同的名称,例如 SnakeCase 的 "GetID" 与 "GetId"
+func suitableMethods(receiver reflect.Value, naming NamingPolicy) (map[string]*callback, error) {
 	cbs := make(map[string]*callback)
 	typ := receiver.Type()
 	for i := 0; i < typ.NumMethod(); i++ {
@@ -151,7 +231,11 @@ func suitableMethods(receiver reflect.Value) map[string]*callback {
 		if cb = makeCallback(method.Func, receiver); cb == nil {
 			continue
 		}
-		cbs[strings2.LowerFirst(method.Name)] = cb
+		name := naming(method.Name)
+		if _, exist := cbs[name]; exist {
+			return nil, errors.Annotate(ErrCallbackNameExist, name)
+		}
+		cbs[name] = cb
 	}
-	return cbs
+	return cbs, nil
 }
@@ -0,0 +1,126 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+	"github.com/smallsung/gopkg/rpc/msgpackrpc"
+)
+
+type listService struct{}
+
+func (listService) Join(sep string, items ...string) string {
+	result := ""
+	for i, item := range items {
+		if i > 0 {
+			result += sep
+		}
+		result += item
+	}
+	return result
+}
+
+func (listService) DivMod(a, b int) (int, int, error) {
+	return a / b, a % b, nil
+}
+
+func (listService) Count(ctx context.Context, n int) <-chan int {
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		for i := 0; i < n; i++ {
+			select {
+			case ch <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func newListServer(t *testing.T, newCodec rpc.NewServerCodecFunc) *rpc.Server {
+	server := rpc.NewServer(newCodec)
+	if err := server.Register("list", listService{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Register("named", listService{}, rpc.ForMethod("divMod", rpc.MethodResultNames("quotient", "remainder"))); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func TestCallbackShapes(t *testing.T) {
+	ctx := context.Background()
+	codecs := []struct {
+		server rpc.NewServerCodecFunc
+		client rpc.NewClientCodecFunc
+	}{
+		{jsonrpc.NewServerCodec, jsonrpc.NewClientCodec},
+		{msgpackrpc.NewServerCodec, msgpackrpc.NewClientCodec},
+	}
+	for _, codec := range codecs {
+		client := rpc.DialInProc(ctx, newListServer(t, codec.server), codec.client)
+
+		for want, args := range map[string][]interface{}{"": {","}, "a": {",", "a"}, "a,b,c": {",", "a", "b", "c"}} {
+			var joined string
+			if err := client.Call(ctx, "list.join", &joined, args...); err != nil {
+				t.Fatal(err)
+			}
+			if joined != want {
+				t.Fatalf("join %v: want %q, got %q", args, want, joined)
+			}
+		}
+
+		var array []int
+		if err := client.Call(ctx, "list.divMod", &array, 7, 2); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(array, []int{3, 1}) {
+			t.Fatalf("divMod: %v", array)
+		}
+		var object struct {
+			Quotient  int `json:"quotient"`
+			Remainder int `json:"remainder"`
+		}
+		if err := client.Call(ctx, "named.divMod", &object, 7, 2); err != nil {
+			t.Fatal(err)
+		}
+		if object.Quotient != 3 || object.Remainder != 1 {
+			t.Fatalf("named divMod: %+v", object)
+		}
+
+		var streamed []int
+		streamCtx := rpc.WithStreamHandler(ctx, func(v rpc.PartialResult) {
+			var i int
+			if err := v.Decode(&i); err != nil {
+				t.Error(err)
+			}
+			streamed = append(streamed, i)
+		})
+		if err := client.Call(streamCtx, "list.count", nil, 3); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(streamed, []int{0, 1, 2}) {
+			t.Fatalf("stream: %v", streamed)
+		}
+		client.Close()
+	}
+
+	httpServer := httptest.NewServer(newListServer(t, jsonrpc.NewServerCodec))
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+	client := rpc.DialHTTP(ctx, URL, jsonrpc.NewClientCodec)
+	var collected []int
+	if err := client.Call(ctx, "list.count", &collected, 3); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(collected, []int{0, 1, 2}) {
+		t.Fatalf("collected stream: %v", collected)
+	}
+}
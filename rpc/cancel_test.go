@@ -0,0 +1,155 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+type blockingService struct {
+	cancelled chan error
+}
+
+func (s blockingService) Wait(ctx context.Context, seconds int) error {
+	select {
+	case <-ctx.Done():
+		s.cancelled <- ctx.Err()
+		return ctx.Err()
+	case <-time.After(time.Duration(seconds) * time.Second):
+		return nil
+	}
+}
+
+func TestCancelCall(t *testing.T) {
+	svc := blockingService{cancelled: make(chan error, 1)}
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("block", svc); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(context.Background(), server, jsonrpc.NewClientCodec)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.Call(ctx, "block.wait", nil, 10); err != context.DeadlineExceeded {
+		t.Fatalf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+	select {
+	case err := <-svc.cancelled:
+		if err != context.Canceled {
+			t.Fatalf("want %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not cancelled")
+	}
+	if n := client.Pending(); n != 0 {
+		t.Fatalf("want no pending calls, got %d", n)
+	}
+}
+
+type noticeService struct {
+	received chan string
+}
+
+func (s noticeService) Record(message string) {
+	s.received <- message
+}
+
+// 只执行内置 rpc 命名空间的通知, 其他通知被忽略
+func TestNotificationIgnored(t *testing.T) {
+	svc := noticeService{received: make(chan string, 1)}
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("notice", svc); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(context.Background(), server, jsonrpc.NewClientCodec)
+	defer client.Close()
+
+	if err := client.Notice(context.Background(), "notice.record", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case message := <-svc.received:
+		t.Fatalf("notification was executed: %s", message)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDuplicateInFlightID(t *testing.T) {
+	svc := blockingService{cancelled: make(chan error, 1)}
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("block", svc); err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(context.Background(), serverConn)
+	defer clientConn.Close()
+
+	decoder := json.NewDecoder(clientConn)
+	var response struct {
+		ID    int
+		Error *struct{ Code int }
+	}
+	for _, raw := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"block.wait","params":[10]}`,
+		`{"jsonrpc":"2.0","id":1,"method":"block.wait","params":[10]}`,
+	} {
+		if _, err := clientConn.Write([]byte(raw)); err != nil {
+			t.Fatal(err)
+		}
+		// 等待第一个调用开始执行
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := decoder.Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.ID != 1 || response.Error == nil || response.Error.Code != -32600 {
+		t.Fatalf("want invalid request for duplicate id, got %+v", response)
+	}
+
+	// 第二个请求没有覆盖第一个调用的取消函数
+	if _, err := clientConn.Write([]byte(`{"jsonrpc":"2.0","method":"rpc.cancel","params":[1]}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-svc.cancelled:
+		if err != context.Canceled {
+			t.Fatalf("want %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first call was not cancelled")
+	}
+}
+
+// rpc.cancel 比被取消的调用先开始处理时, 调用开始后立即被取消
+func TestCancelBeforeCallStarts(t *testing.T) {
+	svc := blockingService{cancelled: make(chan error, 1)}
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("block", svc); err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(context.Background(), serverConn)
+	defer clientConn.Close()
+
+	if _, err := clientConn.Write([]byte(`{"jsonrpc":"2.0","method":"rpc.cancel","params":[1]}`)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err := clientConn.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"block.wait","params":[10]}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-svc.cancelled:
+		if err != context.Canceled {
+			t.Fatalf("want %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("call was not cancelled")
+	}
+}
@@ -20,10 +20,14 @@ type BatchElem struct {
 	Method MessageMethod
 	Params []interface{}
 	Result interface{}
-	Error  error
+	// Error 调用自身的错误. 没有收到响应时为整个批量调用的错误或者 ErrMissingResponse
+	Error error
 
-	id   MessageID
+	id MessageID
+	// done 收到了响应
 	done bool
+	// raw Result 为 nil 时保存响应的结果,由 BatchFuture 解码
+	raw MessageResult
 }
 
 type Call struct {
@@ -32,44 +36,81 @@ type Call struct {
 	waitGroup   sync.WaitGroup
 
 	Result interface{}
-	Error  error
+	// Error 批量调用时只表示整个调用失败,比如传输错误, ctx 结束. 每个调用的错误在 Elems 中
+	Error error
 
 	Elems []BatchElem
 	elems map[string]*BatchElem
+	// bath 由 BathAsync 发送, 保持旧的错误语义: 流式连接上调用的错误同时作为 Error
+	bath bool
 
 	Done chan *Call
+
+	// finish 释放等待响应的调用计数
+	finish func()
+	// abandoned ctx 结束时还没有收到响应的请求ID
+	abandoned []MessageID
+	// progress 通过 WithProgress 设置的进度处理函数
+	progress ProgressHandler
+	// partial 设置了进度或者流的处理函数
+	partial bool
+	// requestsBefore 收到响应时已经到达的服务端请求数量. 结束前等待它们分发完成,保证部分结果先于调用的结果
+	requestsBefore uint64
 }
 
-func (c *Call) done() {
-	c.Done <- c
+// CallOption 放在 CallAsync, Call 的 params 中设置调用的选项, 不作为参数发送
+type CallOption interface {
+	applyCall(call *Call)
 }
 
-func (c *Call) wait() {
-	c.waitGroup.Wait()
-	if c.Done != nil {
-		c.done()
+func (c *Call) done() {
+	if c.finish != nil {
+		c.finish()
 	}
+	c.Done <- c
 }
 
 type Client struct {
 	Logger *zap.Logger
+	// Metrics 为 nil 时不记录监控指标
+	Metrics *ClientMetrics
+	// OnServiceChange 服务端的服务变化时调用,编解码器需要支持双向调用
+	OnServiceChange func(change ServiceChange)
+	// Retry 为 nil 时不重试
+	Retry *RetryPolicy
+	// Breaker 为 nil 时不熔断. 每次重试都经过熔断器
+	Breaker *CircuitBreaker
 
 	isHttp bool
 
 	idCounter uint64
+	pending   int64
 
 	codec ClientCodec
+	// server 处理服务端通过同一个连接发起的调用,编解码器不支持双向调用时为 nil
+	server *Server
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	progress partialHandlers
+	streams  partialHandlers
+	// requests 编解码器支持双向调用时分发服务端发起的请求
+	requests *requestQueue
 
 	calls map[string]*Call
 
 	readError chan error
-	readChan  chan *ResponseMessages
+	readChan  chan readResponses
 	sendChan  chan *Call
 	sentChan  chan error
+	// abandonChan 放弃等待 ctx 已经结束的调用
+	abandonChan chan abandonedCall
 
-	closeChan chan error
+	closing   chan struct{}
+	closeOnce sync.Once
 }
 
+// CallAsync 发送调用,不等待响应. params 中的 CallOption (如 WithProgress) 设置调用的选项, 不作为参数发送
 func (c *Client) CallAsync(ctx context.Context, done chan *Call, method MessageMethod, result interface{}, params ...interface{}) *Call {
 	if cap(done) == 0 {
 		panic("rpc: done channel is unbuffered")
@@ -79,6 +120,7 @@ func (c *Client) CallAsync(ctx context.Context, done chan *Call, method MessageM
 		Result:   result,
 		Done:     done,
 	}
+	params = applyCallOptions(call, params)
 
 	var err error
 	var request *RequestMessage
@@ -98,12 +140,27 @@ func (c *Client) CallAsync(ctx context.Context, done chan *Call, method MessageM
 	return call
 }
 
+// Call 设置了 Retry, Breaker 时按照 RetryPolicy 重试,经过 CircuitBreaker 熔断. CallAsync 不重试也不熔断.
+// params 与 CallAsync 相同,可以包含 CallOption
 func (c *Client) Call(ctx context.Context, method MessageMethod, result interface{}, params ...interface{}) (err error) {
-	call := <-c.CallAsync(ctx, make(chan *Call, 1), method, result, params...).Done
-	return call.Error
+	call := func() error {
+		return (<-c.CallAsync(ctx, make(chan *Call, 1), method, result, params...).Done).Error
+	}
+	if c.Breaker != nil {
+		call = c.Breaker.wrap(method, call)
+	}
+	if c.Retry == nil || !c.Retry.idempotent(ctx, method) {
+		return call()
+	}
+	return c.Retry.do(ctx, c.Logger, method, call)
 }
 
-func (c *Client) BathAsync(ctx context.Context, done chan *Call, elems ...BatchElem) *Call {
+// BatchAsync 在一个批量请求中发送 elems. Call.Error 只表示整个批量调用失败,每个调用的结果与错误在 Call.Elems 中
+func (c *Client) BatchAsync(ctx context.Context, done chan *Call, elems ...BatchElem) *Call {
+	return c.batchAsync(ctx, done, false, elems)
+}
+
+func (c *Client) batchAsync(ctx context.Context, done chan *Call, bath bool, elems []BatchElem) *Call {
 	if cap(done) == 0 {
 		panic("rpc: done channel is unbuffered")
 	}
@@ -112,6 +169,7 @@ func (c *Client) BathAsync(ctx context.Context, done chan *Call, elems ...BatchE
 		Done:     done,
 		Elems:    elems,
 		elems:    make(map[string]*BatchElem),
+		bath:     bath,
 	}
 
 	l := len(elems)
@@ -149,6 +207,18 @@ func (c *Client) BathAsync(ctx context.Context, done chan *Call, elems ...BatchE
 	return call
 }
 
+// Batch 发送 elems 并等待所有响应, 返回整个批量调用的错误. 每个调用的错误在 elems 中
+func (c *Client) Batch(ctx context.Context, elems ...BatchElem) error {
+	call := <-c.BatchAsync(ctx, make(chan *Call, 1), elems...).Done
+	return call.Error
+}
+
+// Deprecated: 使用 BatchAsync. 流式连接上调用的错误同时作为 Call.Error, HTTP 上缺少的响应以 io.EOF 结束
+func (c *Client) BathAsync(ctx context.Context, done chan *Call, elems ...BatchElem) *Call {
+	return c.batchAsync(ctx, done, true, elems)
+}
+
+// Deprecated: 使用 Batch
 func (c *Client) Bath(ctx context.Context, elems ...BatchElem) error {
 	call := <-c.BathAsync(ctx, make(chan *Call, 1), elems...).Done
 	return call.Error
@@ -170,12 +240,34 @@ func (c *Client) Notice(ctx context.Context, method string, params ...interface{
 	return nil
 }
 
+// applyCallOptions 返回去掉 CallOption 之后的参数
+func applyCallOptions(call *Call, params []interface{}) []interface{} {
+	n := 0
+	for _, param := range params {
+		if option, ok := param.(CallOption); ok {
+			option.applyCall(call)
+			continue
+		}
+		n++
+	}
+	if n == len(params) {
+		return params
+	}
+	args := make([]interface{}, 0, n)
+	for _, param := range params {
+		if _, ok := param.(CallOption); !ok {
+			args = append(args, param)
+		}
+	}
+	return args
+}
+
 func (c *Client) buildMessage(method string, params ...interface{}) (*RequestMessage, error) {
 	message := new(RequestMessage)
 	if len(params) > 0 {
 		var err error
 		if message.Params, err = c.codec.MarshalRequestParams(params...); err != nil {
-			return nil, errors.Annotate(err, "codec.MarshalRequestParams")
+			return nil, &EncodeError{errors.Annotate(err, "codec.MarshalRequestParams")}
 		}
 	}
 	message.ID, message.Method = c.nextID(), method
@@ -205,16 +297,47 @@ func (c *Client) removeCall(call *Call) {
 	}
 }
 
-func (c *Client) handleMessages(responses *ResponseMessages) {
+// readResponses 读取到的响应, requestsBefore 是在它之前到达的服务端请求数量
+type readResponses struct {
+	responses      *ResponseMessages
+	requestsBefore uint64
+}
+
+func (c *Client) handleMessages(responses *ResponseMessages, requestsBefore uint64) {
+	var batches []*Call
 	for _, response := range responses.Elems {
 		switch {
 		case response.IsResponse():
+			call := c.calls[string(response.ID)]
+			if call != nil && call.partial {
+				call.requestsBefore = requestsBefore
+			}
+			if call != nil && call.requests.Batch {
+				batches = append(batches, call)
+			}
 			c.handleResponse(response)
-		case response.HasValidID():
-			//todo
 		default:
-			//todo
+			c.Logger.Warn("client.handleMessages:unexpected message", zap.ByteString("id", response.ID))
+		}
+	}
+	if responses.Batch {
+		for _, call := range batches {
+			c.missingResponses(call)
+		}
+	}
+}
+
+// missingResponses 批量响应中缺少的调用不会再收到响应, 以 ErrMissingResponse 结束
+func (c *Client) missingResponses(call *Call) {
+	for _, request := range call.requests.Elems {
+		id := string(request.ID)
+		if request.IsNotification() || c.calls[id] != call {
+			continue
 		}
+		c.Logger.Warn("client.missingResponse", zap.String("id", id), zap.String("method", request.Method))
+		call.elems[id].Error = ErrMissingResponse
+		call.waitGroup.Done()
+		delete(c.calls, id)
 	}
 }
 
@@ -225,27 +348,22 @@ func (c *Client) handleResponse(response *ResponseMessage) {
 	case call == nil:
 		c.Logger.Warn("client.handleMessages:unsolicited RPC response", zap.String("id", id))
 
-	case response.Error != nil:
-		if call.requests.Batch {
-			call.elems[id].Error = response.Error
+	case call.requests.Batch:
+		elem := call.elems[id]
+		elem.handleResponse(c.codec, response)
+		if call.bath && elem.Error != nil {
+			call.Error = elem.Error
 		}
-		call.Error = response.Error
 		call.waitGroup.Done()
-	default:
-		var result interface{}
-		if !call.requests.Batch {
-			result = call.Result
-		} else {
-			result = call.elems[id].Result
-		}
 
-		if result != nil {
-			err := errors.Annotate(c.codec.UnmarshalResponseResult(response.Result, result), "codec.UnmarshalResponseResult")
+	case response.Error != nil:
+		call.Error = decodeError(c.codec, response.Error)
+		call.waitGroup.Done()
+	default:
+		if call.Result != nil {
+			err := errors.Annotate(c.codec.UnmarshalResponseResult(response.Result, call.Result), "codec.UnmarshalResponseResult")
 			if err != nil {
-				if call.requests.Batch {
-					call.elems[id].Error = err
-				}
-				call.Error = err
+				call.Error = &ResultError{err}
 			}
 		}
 
@@ -264,7 +382,8 @@ func (c *Client) loop() {
 	for {
 		select {
 
-		case <-c.closeChan:
+		case <-c.closing:
+			c.failCalls(ErrClientClosed)
 			return
 
 		case call := <-sendChan:
@@ -280,19 +399,157 @@ func (c *Client) loop() {
 			sendChan, lastCall = c.sendChan, nil
 
 		case err := <-c.readError:
-			if err != nil {
-				c.Logger.Warn("client.readError", zap.Error(err))
+			c.Logger.Warn("client.readError", zap.Error(err))
+			if !isRecoverableError(err) {
+				// 连接已经不可用
+				c.failCalls(err)
+				c.Close()
 			}
 
-		case responses := <-c.readChan:
-			c.handleMessages(responses)
+		case read := <-c.readChan:
+			c.handleMessages(read.responses, read.requestsBefore)
+
+		case abandoned := <-c.abandonChan:
+			c.abandon(abandoned.call, abandoned.err)
+		}
+	}
+}
+
+type abandonedCall struct {
+	call *Call
+	err  error
+}
+
+// abandon 结束 call 中还没有收到响应的请求
+func (c *Client) abandon(call *Call, err error) {
+	for _, request := range call.requests.Elems {
+		id := string(request.ID)
+		if request.IsNotification() || c.calls[id] != call {
+			continue
 		}
+		if call.requests.Batch {
+			call.elems[id].Error = err
+		}
+		call.Error = err
+		call.abandoned = append(call.abandoned, request.ID)
+		call.waitGroup.Done()
+		delete(c.calls, id)
+	}
+}
+
+// wait 等待 call 的所有响应. ctx 先结束时放弃等待,并通过 rpc.cancel 通知服务端取消还没有响应的调用
+func (c *Client) wait(ctx context.Context, call *Call) {
+	if ctx.Done() == nil || call.Done == nil {
+		call.waitGroup.Wait()
+		c.requests.wait(call.requestsBefore)
+		if call.Done != nil {
+			call.done()
+		}
+		return
+	}
+	finished := make(chan struct{})
+	go func() {
+		call.waitGroup.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		select {
+		case c.abandonChan <- abandonedCall{call: call, err: ctx.Err()}:
+		case <-c.closing:
+		}
+		<-finished
+		if len(call.abandoned) > 0 {
+			c.contextDone(ctx, call)
+		}
+		for _, id := range call.abandoned {
+			c.sendCancel(id)
+		}
+	}
+	c.requests.wait(call.requestsBefore)
+	call.done()
+}
+
+func (c *Client) sendCancel(id MessageID) {
+	if err := c.Notice(context.Background(), cancelMethod, decodeMessageID(id)); err != nil {
+		c.Logger.Debug("client.sendCancel", zap.ByteString("id", id), zap.Error(err))
+	}
+}
+
+// failCalls 结束所有等待响应的调用
+func (c *Client) failCalls(err error) {
+	for id, call := range c.calls {
+		if call.requests.Batch {
+			call.elems[id].Error = err
+		}
+		call.Error = err
+		call.waitGroup.Done()
+		delete(c.calls, id)
+	}
+}
+
+// Pending 返回已发送但还没有收到响应的调用数量
+func (c *Client) Pending() int {
+	return int(atomic.LoadInt64(&c.pending))
+}
+
+// CircuitState 返回 method 的熔断状态, method 为空时返回节点的状态. 没有设置 Breaker 时总是 CircuitClosed
+func (c *Client) CircuitState(method string) CircuitState {
+	if c.Breaker == nil {
+		return CircuitClosed
+	}
+	return c.Breaker.State(method)
+}
+
+// trackPending 记录等待响应的调用数量,在 Call.done 时释放
+func (c *Client) trackPending(call *Call) {
+	n := 0
+	for _, request := range call.requests.Elems {
+		if !request.IsNotification() {
+			n++
+		}
+	}
+	if n == 0 {
+		return
+	}
+	atomic.AddInt64(&c.pending, int64(n))
+	c.Metrics.pendingAdd(n)
+	var once sync.Once
+	call.finish = func() {
+		once.Do(func() {
+			atomic.AddInt64(&c.pending, -int64(n))
+			c.Metrics.pendingAdd(-n)
+		})
+	}
+}
+
+func (c *Client) contextDone(ctx context.Context, call *Call) {
+	if ctx.Err() == context.DeadlineExceeded {
+		c.Metrics.timeout(call.requests)
 	}
 }
 
 func (c *Client) sendCall(ctx context.Context, call *Call) (err error) {
+	sc := SpanContextFromContext(ctx)
+	if sc.IsValid() && !c.isHttp {
+		for _, request := range call.requests.Elems {
+			request.TraceParent = sc.TraceParent()
+		}
+	}
 	if call.requestsRaw, err = c.codec.MarshalRequest(call.requests); err != nil {
-		return errors.Annotate(err, "codec.MarshalRequest")
+		return &EncodeError{errors.Annotate(err, "codec.MarshalRequest")}
+	}
+	c.Metrics.sent(call.requests)
+	c.trackPending(call)
+	if call.progress != nil && c.server != nil {
+		c.progress.add(call, call.progress)
+		call.partial = true
+	}
+	if handler := streamHandlerFromContext(ctx); handler != nil && c.server != nil {
+		c.streams.add(call, handler)
+		call.partial = true
 	}
 
 	if c.isHttp {
@@ -301,12 +558,19 @@ func (c *Client) sendCall(ctx context.Context, call *Call) (err error) {
 
 	select {
 	case <-ctx.Done():
+		c.contextDone(ctx, call)
 		return ctx.Err()
+	case <-c.closing:
+		return ErrClientClosed
 	case c.sendChan <- call:
 		err = c.writeRequest(call.requestsRaw)
-		c.sentChan <- err
+		select {
+		case c.sentChan <- err:
+		case <-c.closing:
+			// loop 已经退出,并且结束了 call 中的所有请求
+		}
 		if err == nil {
-			go call.wait()
+			go c.wait(ctx, call)
 		}
 		return errors.Annotate(err, "client.sendCall")
 	}
@@ -318,6 +582,13 @@ func (c *Client) sendHttp(ctx context.Context, call *Call) (err error) {
 	if request, err = http.NewRequestWithContext(ctx, http.MethodPost, httpCodec.url.String(), bytes.NewReader(call.requestsRaw)); err != nil {
 		return errors.Trace(err)
 	}
+	if ct, ok := httpCodec.ClientCodec.(ContentTyper); ok {
+		request.Header.Set("Content-Type", ct.ContentType())
+		request.Header.Set("Accept", ct.ContentType())
+	}
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		request.Header.Set(TraceParentHeader, sc.TraceParent())
+	}
 
 	go func() {
 		var err error
@@ -330,6 +601,7 @@ func (c *Client) sendHttp(ctx context.Context, call *Call) (err error) {
 
 		var httpResponse *http.Response
 		if httpResponse, err = httpCodec.client.Do(request); err != nil {
+			c.contextDone(ctx, call)
 			err = errors.Trace(err)
 			return
 		}
@@ -357,33 +629,36 @@ func (c *Client) sendHttp(ctx context.Context, call *Call) (err error) {
 		if !call.requests.Batch {
 			switch {
 			case call.requests.Elems[0].IsNotification():
+			case len(responses.Elems) == 0:
+				err = ErrMissingResponse
 			case responses.Elems[0].Error != nil:
-				err = errors.Trace(err)
+				err = decodeError(c.codec, responses.Elems[0].Error)
 			default:
 				if err = c.codec.UnmarshalResponseResult(responses.Elems[0].Result, call.Result); err != nil {
-					err = errors.Annotate(err, "httpCodec.UnmarshalResponseResult")
+					err = &ResultError{errors.Annotate(err, "httpCodec.UnmarshalResponseResult")}
 				}
 			}
 			return
 		}
 
 		for _, response := range responses.Elems {
-			switch {
-			case response.Error != nil:
-				call.elems[string(response.ID)].Error = response.Error
-			default:
-				if err = c.codec.UnmarshalResponseResult(response.Result, call.elems[string(response.ID)].Result); err != nil {
-					call.elems[string(response.ID)].Error = errors.Annotate(err, "httpCodec.UnmarshalResponseResult")
+			if elem := call.elems[string(response.ID)]; elem != nil {
+				elem.handleResponse(c.codec, response)
+				// BathAsync: 只有最后一个结果的解码错误作为 Call.Error
+				if call.bath && response.Error == nil {
+					err = elem.Error
 				}
 			}
-			call.elems[string(response.ID)].done = true
 		}
 
 		for _, elem := range call.elems {
-			if elem.done {
-				continue
+			if !elem.done {
+				if call.bath {
+					elem.Error = io.EOF
+				} else {
+					elem.Error = ErrMissingResponse
+				}
 			}
-			elem.Error = io.EOF
 		}
 		return
 	}()
@@ -403,38 +678,70 @@ func (c *Client) read() {
 		var raw RawMessage
 		var err error
 		if raw, err = c.codec.ReadResponse(); err != nil {
-			c.readError <- errors.Annotate(err, "codec.ReadResponse")
+			select {
+			case c.readError <- errors.Annotate(err, "codec.ReadResponse"):
+			case <-c.closing:
+				return
+			}
+			if !isRecoverableError(err) {
+				return
+			}
 			continue
 		}
 
 		c.Logger.Debug("client.readResponse", zap.String("raw", string(raw)))
 
+		if duplex, ok := c.codec.(DuplexClientCodec); ok && c.requests != nil && duplex.IsRequest(raw) {
+			c.requests.push(raw)
+			continue
+		}
+
 		var response *ResponseMessages
 		if response, err = c.codec.UnmarshalResponse(raw); err != nil {
-			c.readError <- errors.Annotate(err, "codec.UnmarshalResponse")
+			c.Logger.Warn("client.readError", zap.Error(errors.Annotate(err, "codec.UnmarshalResponse")))
 			continue
 		}
-		c.readChan <- response
+		select {
+		case c.readChan <- readResponses{responses: response, requestsBefore: c.requests.position()}:
+		case <-c.closing:
+			return
+		}
 	}
 }
 
+// Close 关闭连接,等待响应的调用返回 ErrClientClosed
 func (c *Client) Close() {
-	c.closeChan <- nil
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		c.cancel()
+		c.requests.close()
+		_ = c.codec.Close()
+	})
 }
 
 func NewClient(codec ClientCodec) *Client {
 	_, isHttp := codec.(*httpClientCodec)
 	c := &Client{
-		Logger:    zap.NewNop(),
-		isHttp:    isHttp,
-		idCounter: 0,
-		codec:     codec,
-		calls:     make(map[string]*Call),
-		readError: make(chan error),
-		readChan:  make(chan *ResponseMessages),
-		sendChan:  make(chan *Call),
-		sentChan:  make(chan error),
-		closeChan: make(chan error),
+		Logger:      zap.NewNop(),
+		isHttp:      isHttp,
+		idCounter:   0,
+		codec:       codec,
+		calls:       make(map[string]*Call),
+		readError:   make(chan error),
+		readChan:    make(chan readResponses),
+		sendChan:    make(chan *Call),
+		sentChan:    make(chan error),
+		abandonChan: make(chan abandonedCall),
+		closing:     make(chan struct{}),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	if _, ok := codec.(DuplexClientCodec); ok {
+		// 服务端发起的通知都需要执行
+		c.server = NewServer(nil)
+		c.server.notifications = true
+		_ = c.server.Register(builtinServiceName, clientBuiltinService{c})
+		c.requests = newRequestQueue()
+		go c.requests.run(c.dispatchRequest)
 	}
 	if !isHttp {
 		go c.loop()
@@ -0,0 +1,148 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/smallsung/gopkg/errors"
+)
+
+// Connection 由 Server.ServeCodec 处理的流式连接(IPC,进程内)
+type Connection struct {
+	ID          uint64
+	Peer        Peer
+	ConnectedAt time.Time
+
+	codec   ServerCodec
+	session *Session
+	// client 编解码器支持双向调用时,通过连接调用客户端方法
+	client  *Client
+	reverse *reverseClientCodec
+
+	mu    sync.Mutex
+	calls map[string]context.CancelFunc
+	// cancelled 先于调用到达的 rpc.cancel. 每个消息在独立的 goroutine 中处理, 取消可能比调用先开始
+	cancelled map[string]time.Time
+}
+
+// earlyCancelTTL 先到达的取消保留的时间
+const earlyCancelTTL = 10 * time.Second
+
+// Client 返回可以调用客户端方法的 Client, 编解码器不支持双向调用时返回 nil
+func (conn *Connection) Client() *Client {
+	return conn.client
+}
+
+// Session 返回连接的会话
+func (conn *Connection) Session() *Session {
+	return conn.session
+}
+
+// Connections 返回当前所有的连接
+func (s *Server) Connections() []*Connection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	connections := make([]*Connection, 0, len(s.connections))
+	for _, conn := range s.connections {
+		connections = append(connections, conn)
+	}
+	return connections
+}
+
+// addConnection 服务已经关闭时返回 nil
+func (s *Server) addConnection(ctx context.Context, codec ServerCodec) *Connection {
+	conn := &Connection{
+		Peer:        PeerFromContext(ctx),
+		ConnectedAt: time.Now(),
+		codec:       codec,
+		session:     newSession(),
+		calls:       make(map[string]context.CancelFunc),
+		cancelled:   make(map[string]time.Time),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if atomic.LoadUint32(&s.running) == 0 {
+		return nil
+	}
+	s.connectionCount++
+	conn.ID = s.connectionCount
+	s.connections[conn.ID] = conn
+	return conn
+}
+
+func (s *Server) removeConnection(conn *Connection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.connections, conn.ID)
+}
+
+// startCall 记录正在执行的调用, 返回的 ctx 可以被 cancelCall 取消.
+// 调用的取消已经先到达时, 返回的 ctx 已经取消. 连接上已经有相同ID的调用正在执行时返回 false
+func (conn *Connection) startCall(ctx context.Context, id MessageID) (context.Context, func(), bool) {
+	conn.mu.Lock()
+	if _, ok := conn.calls[string(id)]; ok {
+		conn.mu.Unlock()
+		return ctx, nil, false
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	conn.calls[string(id)] = cancel
+	if at, ok := conn.cancelled[string(id)]; ok {
+		delete(conn.cancelled, string(id))
+		if time.Since(at) < earlyCancelTTL {
+			cancel()
+		}
+	}
+	conn.mu.Unlock()
+	return ctx, func() {
+		conn.mu.Lock()
+		delete(conn.calls, string(id))
+		conn.mu.Unlock()
+		cancel()
+	}, true
+}
+
+// cancelCall 取消正在执行的调用. 调用还没有开始时记录下来, 在 earlyCancelTTL 内开始的调用会立即被取消.
+// 没有正在执行的调用时返回 false
+func (conn *Connection) cancelCall(id MessageID) bool {
+	conn.mu.Lock()
+	cancel, ok := conn.calls[string(id)]
+	if !ok {
+		now := time.Now()
+		for key, at := range conn.cancelled {
+			if now.Sub(at) >= earlyCancelTTL {
+				delete(conn.cancelled, key)
+			}
+		}
+		conn.cancelled[string(id)] = now
+	}
+	conn.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+func withConnection(ctx context.Context, conn *Connection) context.Context {
+	return context.WithValue(ctx, connectionContextKey, conn)
+}
+
+// isClosedError 对端断开或者连接已经关闭,不能再继续读取. 超时与临时错误不是
+func isClosedError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.ErrClosedPipe) || errors.Is(err, net.ErrClosed) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && !opErr.Timeout() && !opErr.Temporary()
+}
+
+// isRecoverableError 编解码器已经跳过错误的消息,可以继续读取
+func isRecoverableError(err error) bool {
+	var re RecoverableError
+	return errors.As(err, &re) && re.Recoverable()
+}
@@ -0,0 +1,71 @@
+package rpc_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+func TestConnectionClosedByPeer(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []string
+		closed error
+	)
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("math", mathService{}); err != nil {
+		t.Fatal(err)
+	}
+	server.OnConnect = func(conn *rpc.Connection) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, "connect")
+	}
+	server.OnDisconnect = func(conn *rpc.Connection, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, "disconnect")
+		closed = err
+	}
+
+	serverConn, clientConn := net.Pipe()
+	served := make(chan struct{})
+	go func() {
+		server.ServeConn(context.Background(), serverConn)
+		close(served)
+	}()
+
+	client := rpc.NewClient(jsonrpc.NewClientCodec(clientConn))
+	var sum int
+	if err := client.Call(context.Background(), "math.add", &sum, 1, 2); err != nil || sum != 3 {
+		t.Fatalf("want 3, got %d %v", sum, err)
+	}
+	if n := len(server.Connections()); n != 1 {
+		t.Fatalf("want 1 connection, got %d", n)
+	}
+
+	// 对端关闭后读取错误不能被当作可以跳过的错误,否则 ServeConn 会一直循环
+	client.Close()
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeConn did not return after the client closed")
+	}
+
+	if n := len(server.Connections()); n != 0 {
+		t.Fatalf("want 0 connections, got %d", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 || events[0] != "connect" || events[1] != "disconnect" {
+		t.Fatalf("unexpected hook order %v", events)
+	}
+	if closed == nil {
+		t.Fatal("OnDisconnect: want read error")
+	}
+}
@@ -0,0 +1,94 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+type contextKey int
+
+const (
+	debugErrorContextKey contextKey = iota
+	requestIDContextKey
+	loggerContextKey
+	peerContextKey
+	spanContextKey
+	connectionContextKey
+	requestContextKey
+	clientContextKey
+	streamHandlerContextKey
+	idempotentContextKey
+)
+
+// WithDebugError 标记请求的错误响应包含完整的错误链.
+// 只应该由可信的调用方使用,比如进程内连接
+func WithDebugError(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugErrorContextKey, true)
+}
+
+func isDebugError(ctx context.Context) bool {
+	debug, _ := ctx.Value(debugErrorContextKey).(bool)
+	return debug
+}
+
+// RequestIDFromContext 返回当前请求的ID. HTTP 请求优先使用请求头 RequestIDHeader
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// LoggerFromContext 返回包含当前请求ID的 Logger, 回调可以使用它记录与访问日志相同ID的日志
+func LoggerFromContext(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(loggerContextKey).(*zap.Logger); ok {
+		return logger
+	}
+	return zap.NewNop()
+}
+
+// Peer 请求的来源
+type Peer struct {
+	// Transport 传输方式: http, unix, tcp, pipe(进程内)
+	Transport  string
+	RemoteAddr string
+	// HTTPHeader HTTP 请求的请求头,其他传输方式为 nil. 不应该修改
+	HTTPHeader http.Header
+}
+
+func withPeer(ctx context.Context, p Peer) context.Context {
+	return context.WithValue(ctx, peerContextKey, p)
+}
+
+// PeerFromContext 返回请求的来源. 直接调用 Server.ServeCodec 时可能为空
+func PeerFromContext(ctx context.Context) Peer {
+	p, _ := ctx.Value(peerContextKey).(Peer)
+	return p
+}
+
+// RequestFromContext 返回回调正在处理的请求,不在回调中时返回 nil
+func RequestFromContext(ctx context.Context) *RequestMessage {
+	request, _ := ctx.Value(requestContextKey).(*RequestMessage)
+	return request
+}
+
+// MethodFromContext 返回回调正在处理的方法名
+func MethodFromContext(ctx context.Context) string {
+	if request := RequestFromContext(ctx); request != nil {
+		return request.Method
+	}
+	return ""
+}
+
+// ClientFromContext 返回可以调用对端方法的 Client.
+// 服务端回调中是连接另一端的客户端,客户端回调中是客户端自己. HTTP 请求或者编解码器不支持双向调用时返回 nil
+func ClientFromContext(ctx context.Context) *Client {
+	client, _ := ctx.Value(clientContextKey).(*Client)
+	return client
+}
+
+// ConnectionFromContext 返回请求所在的流式连接, HTTP 请求返回 nil
+func ConnectionFromContext(ctx context.Context) *Connection {
+	conn, _ := ctx.Value(connectionContextKey).(*Connection)
+	return conn
+}
@@ -0,0 +1,74 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+type RequestInfo struct {
+	Method     string `json:"method"`
+	ID         string `json:"id"`
+	Transport  string `json:"transport"`
+	RemoteAddr string `json:"remoteAddr"`
+	UserAgent  string `json:"userAgent"`
+	Connection bool   `json:"connection"`
+}
+
+type inspectService struct{}
+
+func (inspectService) Inspect(ctx context.Context) RequestInfo {
+	peer := rpc.PeerFromContext(ctx)
+	info := RequestInfo{
+		Method:     rpc.MethodFromContext(ctx),
+		Transport:  peer.Transport,
+		RemoteAddr: peer.RemoteAddr,
+		UserAgent:  peer.HTTPHeader.Get("User-Agent"),
+		Connection: rpc.ConnectionFromContext(ctx) != nil,
+	}
+	if request := rpc.RequestFromContext(ctx); request != nil {
+		info.ID = string(request.ID)
+	}
+	return info
+}
+
+func TestContextAccessors(t *testing.T) {
+	ctx := context.Background()
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("inspect", inspectService{}); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+
+	client := rpc.DialHTTP(ctx, URL, jsonrpc.NewClientCodec)
+	var info RequestInfo
+	if err := client.Call(ctx, "inspect.inspect", &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Method != "inspect.inspect" || info.ID == "" || info.Transport != "http" ||
+		info.RemoteAddr == "" || info.UserAgent == "" || info.Connection {
+		t.Fatalf("http: unexpected %+v", info)
+	}
+
+	client = rpc.DialInProc(ctx, server, jsonrpc.NewClientCodec)
+	defer client.Close()
+	info = RequestInfo{}
+	if err := client.Call(ctx, "inspect.inspect", &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Method != "inspect.inspect" || info.ID == "" || info.Transport != "pipe" ||
+		info.UserAgent != "" || !info.Connection {
+		t.Fatalf("pipe: unexpected %+v", info)
+	}
+
+	// 不在回调中时返回零值
+	if rpc.RequestFromContext(ctx) != nil || rpc.MethodFromContext(ctx) != "" || rpc.ConnectionFromContext(ctx) != nil {
+		t.Fatal("want zero values outside callbacks")
+	}
+}
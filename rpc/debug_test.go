@@ -0,0 +1,117 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/smallsung/gopkg/errors"
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+	"github.com/smallsung/gopkg/rpc/msgpackrpc"
+)
+
+func TestDebugError(t *testing.T) {
+	const body = `{"jsonrpc":"2.0","id":1,"method":"wallet.pay","params":[10]}`
+	post := func(t *testing.T, server *rpc.Server, token string) string {
+		httpServer := httptest.NewServer(server)
+		defer httpServer.Close()
+		request, _ := http.NewRequest(http.MethodPost, httpServer.URL, bytes.NewBufferString(body))
+		request.Header.Set("Content-Type", jsonrpc.ContentType)
+		if token != "" {
+			request.Header.Set(rpc.DebugErrorHeader, token)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var v struct{ Error jsonrpc.MessageError }
+		if err := json.NewDecoder(response.Body).Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v.Error.Message
+	}
+	newServer := func(debug bool, token string) *rpc.Server {
+		server := rpc.NewServer(jsonrpc.NewServerCodec)
+		server.DebugError, server.DebugErrorToken = debug, token
+		if err := server.Register("wallet", walletService{}); err != nil {
+			t.Fatal(err)
+		}
+		return server
+	}
+
+	const plain = "insufficient balance: need 10, have 1"
+	tests := []struct {
+		name   string
+		server *rpc.Server
+		token  string
+		debug  bool
+	}{
+		{"token missing", newServer(false, "secret"), "", false},
+		{"token wrong", newServer(false, "secret"), "guess", false},
+		{"token correct", newServer(false, "secret"), "secret", true},
+		{"no token configured", newServer(false, ""), "secret", false},
+		{"DebugError", newServer(true, ""), "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := post(t, test.server, test.token)
+			if debug := strings.Contains(message, "errorcode_test.go"); debug != test.debug {
+				t.Fatalf("want debug %v, got %q", test.debug, message)
+			}
+			if !test.debug && message != plain {
+				t.Fatalf("want %q, got %q", plain, message)
+			}
+		})
+	}
+}
+
+// 带有 data 的错误同样返回 ErrorID, 服务端日志记录完整的错误信息
+func TestErrorID(t *testing.T) {
+	codecs := []struct {
+		server rpc.NewServerCodecFunc
+		client rpc.NewClientCodecFunc
+	}{
+		{jsonrpc.NewServerCodec, jsonrpc.NewClientCodec},
+		{msgpackrpc.NewServerCodec, msgpackrpc.NewClientCodec},
+	}
+	for _, codec := range codecs {
+		core, logs := observer.New(zapcore.DebugLevel)
+		server := rpc.NewServer(codec.server)
+		server.Logger = zap.New(core)
+		if err := server.Register("wallet", walletService{}); err != nil {
+			t.Fatal(err)
+		}
+		client := rpc.DialInProc(context.Background(), server, codec.client)
+		err := client.Call(context.Background(), "wallet.pay", nil, 10)
+		client.Close()
+
+		var codeErr *rpc.CodeError
+		if !errors.As(err, &codeErr) || codeErr.ErrorID == "" {
+			t.Fatalf("want CodeError with ErrorID, got %#v", err)
+		}
+		if _, ok := codeErr.Data.(insufficientBalance); !ok {
+			t.Fatalf("unexpected data %#v", codeErr.Data)
+		}
+		entries := logs.FilterMessage("server.callback").AllUntimed()
+		if len(entries) != 1 {
+			t.Fatalf("want 1 server.callback log, got %d", len(entries))
+		}
+		fields := entries[0].ContextMap()
+		if fields["errorId"] != codeErr.ErrorID {
+			t.Fatalf("want errorId %q, got %v", codeErr.ErrorID, fields["errorId"])
+		}
+		if details, _ := fields["details"].(string); !strings.Contains(details, "stacks:") || !strings.Contains(details, "errorcode_test.go") {
+			t.Fatalf("want full details, got %q", details)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/smallsung/gopkg/errors"
+)
+
+// reverseClientCodec 服务端通过连接调用客户端方法时使用的 ClientCodec.
+// 请求通过 WriteResponse 写入连接, 响应由 Server.serveConnection 读取后转交
+type reverseClientCodec struct {
+	DuplexServerCodec
+	responses chan RawMessage
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newReverseClientCodec(codec DuplexServerCodec) *reverseClientCodec {
+	return &reverseClientCodec{
+		DuplexServerCodec: codec,
+		responses:         make(chan RawMessage),
+		closed:            make(chan struct{}),
+	}
+}
+
+func (codec *reverseClientCodec) WriteRequest(raw RawMessage) error {
+	return codec.WriteResponse(raw)
+}
+
+func (codec *reverseClientCodec) ReadResponse() (RawMessage, error) {
+	select {
+	case raw := <-codec.responses:
+		return raw, nil
+	case <-codec.closed:
+		return nil, ErrClientClosed
+	}
+}
+
+// deliver 转交连接上读取到的响应
+func (codec *reverseClientCodec) deliver(raw RawMessage) {
+	select {
+	case codec.responses <- raw:
+	case <-codec.closed:
+	}
+}
+
+// Close 不关闭连接,连接由 Server.ServeCodec 关闭
+func (codec *reverseClientCodec) Close() error {
+	codec.closeOnce.Do(func() { close(codec.closed) })
+	return nil
+}
+
+// clientServerCodec 客户端处理服务端请求时使用的 ServerCodec, 响应通过 WriteRequest 写入连接
+type clientServerCodec struct {
+	DuplexClientCodec
+}
+
+func (codec clientServerCodec) ReadRequest() (RawMessage, error) {
+	return nil, errors.New("clientServerCodec.ReadRequest: not supported")
+}
+
+func (codec clientServerCodec) WriteResponse(raw RawMessage) error {
+	return codec.WriteRequest(raw)
+}
+
+// Close 不关闭连接,连接由 Client.Close 关闭
+func (codec clientServerCodec) Close() error {
+	return nil
+}
+
+// Register 注册可以由服务端通过同一个连接调用的服务.
+// 编解码器需要实现 DuplexClientCodec, HTTP 客户端不支持
+func (c *Client) Register(namespace string, receiver interface{}, opts ...MethodOption) error {
+	if c.server == nil {
+		return errors.Format("%T doesn't support bidirectional calls", c.codec)
+	}
+	return c.server.Register(namespace, receiver, opts...)
+}
+
+// RegisterFunc 与 Server.RegisterFunc 相同
+func (c *Client) RegisterFunc(namespace, method string, fn interface{}, opts ...MethodOption) error {
+	if c.server == nil {
+		return errors.Format("%T doesn't support bidirectional calls", c.codec)
+	}
+	return c.server.RegisterFunc(namespace, method, fn, opts...)
+}
+
+func isNotifications(requests *RequestMessages) bool {
+	for _, request := range requests.Elems {
+		if !request.IsNotification() {
+			return false
+		}
+	}
+	return len(requests.Elems) > 0
+}
+
+// clientBuiltinService 客户端处理服务端发起的内置调用
+type clientBuiltinService struct {
+	client *Client
+}
+
+// requestQueue 在单独的 goroutine 中按照到达的顺序分发服务端发起的请求, 读取循环不会被处理函数阻塞
+type requestQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []RawMessage
+	// queued, handled 已经到达,已经分发的请求数量
+	queued  uint64
+	handled uint64
+	closed  bool
+}
+
+func newRequestQueue() *requestQueue {
+	q := new(requestQueue)
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *requestQueue) push(raw RawMessage) {
+	q.mu.Lock()
+	q.pending = append(q.pending, raw)
+	q.queued++
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// position 返回已经到达的请求数量
+func (q *requestQueue) position() uint64 {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queued
+}
+
+// wait 等待前 position 个请求分发完成
+func (q *requestQueue) wait(position uint64) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	for q.handled < position && !q.closed {
+		q.cond.Wait()
+	}
+	q.mu.Unlock()
+}
+
+// run 依次分发请求,直到 close
+func (q *requestQueue) run(dispatch func(RawMessage)) {
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		raw := q.pending[0]
+		q.pending[0], q.pending = nil, q.pending[1:]
+		q.mu.Unlock()
+
+		dispatch(raw)
+
+		q.mu.Lock()
+		q.handled++
+		q.mu.Unlock()
+		q.cond.Broadcast()
+	}
+}
+
+func (q *requestQueue) close() {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	q.closed = true
+	q.pending = nil
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// dispatchRequest 通知按照到达的顺序依次处理,保证进度通知先于调用的结果. 带ID的请求并发处理
+func (c *Client) dispatchRequest(raw RawMessage) {
+	if requests, err := c.codec.(DuplexClientCodec).UnmarshalRequest(raw); err == nil && isNotifications(requests) {
+		c.serveRequest(raw)
+	} else {
+		go c.serveRequest(raw)
+	}
+}
+
+// serveRequest 处理服务端发起的请求
+func (c *Client) serveRequest(raw RawMessage) {
+	ctx := context.WithValue(c.ctx, clientContextKey, c)
+	_ = c.server.serveRequest(ctx, clientServerCodec{c.codec.(DuplexClientCodec)}, raw)
+}
@@ -0,0 +1,93 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/smallsung/gopkg/errors"
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+type confirmService struct{}
+
+func (confirmService) Confirm(message string) bool {
+	return message == "delete a"
+}
+
+type fileService struct{}
+
+func (fileService) Delete(ctx context.Context, name string) (bool, error) {
+	client := rpc.ClientFromContext(ctx)
+	if client == nil {
+		return false, errors.New("no client")
+	}
+	var ok bool
+	if err := client.Call(ctx, "ui.confirm", &ok, "delete "+name); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+func TestBidirectionalCall(t *testing.T) {
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("file", fileService{}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(context.Background(), server, jsonrpc.NewClientCodec)
+	defer client.Close()
+	if err := client.Register("ui", confirmService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{"a": true, "b": false} {
+		var deleted bool
+		if err := client.Call(context.Background(), "file.delete", &deleted, name); err != nil {
+			t.Fatal(err)
+		}
+		if deleted != want {
+			t.Fatalf("delete %s: want %v, got %v", name, want, deleted)
+		}
+	}
+}
+
+type alertService struct{}
+
+// Alert 先通知客户端,再返回结果
+func (alertService) Alert(ctx context.Context) (int, error) {
+	if err := rpc.ClientFromContext(ctx).Notice(ctx, "ui.block"); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+type blockService struct {
+	release chan struct{}
+}
+
+func (s blockService) Block() {
+	<-s.release
+}
+
+func TestSlowNotificationHandler(t *testing.T) {
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("alert", alertService{}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(context.Background(), server, jsonrpc.NewClientCodec)
+	defer client.Close()
+	release := make(chan struct{})
+	defer close(release)
+	if err := client.Register("ui", blockService{release: release}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 处理通知的回调阻塞时,读取循环仍然可以收到响应
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var n int
+	if err := client.Call(ctx, "alert.alert", &n); err != nil || n != 1 {
+		t.Fatalf("want 1, got %d %v", n, err)
+	}
+}
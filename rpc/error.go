@@ -1,10 +1,54 @@
 package rpc
 
 import (
+	"context"
 	"fmt"
+
+	"github.com/smallsung/gopkg/errors"
+)
+
+var (
+	ErrCallbackNameExist = fmt.Errorf("callback name exist")
+	// ErrClientClosed 客户端已经关闭或者连接已经断开,调用没有收到响应
+	ErrClientClosed = fmt.Errorf("client closed")
+	// ErrNoEndpoint Balancer 没有可以使用的节点
+	ErrNoEndpoint = fmt.Errorf("no endpoint available")
+	// ErrMissingResponse 服务端的批量响应中没有这个调用的响应
+	ErrMissingResponse = fmt.Errorf("missing response")
+	// ErrBatchSent BatchBuilder 已经发送,不能再添加调用或者再次发送
+	ErrBatchSent = fmt.Errorf("batch already sent")
+	// ErrBatchNotSent BatchBuilder 还没有发送, 没有可以等待的响应
+	ErrBatchNotSent = fmt.Errorf("batch not sent")
 )
 
-var ErrCallbackNameExist = fmt.Errorf("callback name exist")
+// ResultError 收到了响应,但是结果无法解码到调用方提供的变量
+type ResultError struct {
+	error
+}
+
+func (err *ResultError) Unwrap() error { return err.error }
+
+// EncodeError 请求在本地编码失败,没有发送
+type EncodeError struct {
+	error
+}
+
+func (err *EncodeError) Unwrap() error { return err.error }
+
+// IsTransportError err 是调用没有得到服务端响应的错误,比如连接断开,发送失败.
+// 服务端返回的错误, ResultError, EncodeError 与 ctx 结束都不是
+func IsTransportError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var (
+		me *MessageError
+		ec ErrorCode
+		re *ResultError
+		ee *EncodeError
+	)
+	return !errors.As(err, &me) && !errors.As(err, &ec) && !errors.As(err, &re) && !errors.As(err, &ee)
+}
 
 type (
 	ErrorMessage interface{ RPCErrorMessage() string }
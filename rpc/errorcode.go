@@ -0,0 +1,143 @@
+package rpc
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+	"text/template"
+
+	"github.com/smallsung/gopkg/errors"
+)
+
+// ErrorKind 服务声明的命名错误码.
+// 它实现了 error, 可以作为 errors.Is 的 target 判断 CodeError 的种类
+type ErrorKind struct {
+	Code     int64
+	Name     string
+	template *template.Template
+	dataType reflect.Type
+}
+
+func (kind *ErrorKind) Error() string       { return kind.Name }
+func (kind *ErrorKind) RPCErrorCode() int64 { return kind.Code }
+
+// DataType 返回错误数据的类型.未声明时返回 nil
+func (kind *ErrorKind) DataType() reflect.Type { return kind.dataType }
+
+// New 使用 data 渲染消息模版,返回包含调用栈信息的 CodeError.
+// data 的类型与 DefineError 时声明的不一致时返回 ErrInternalError
+func (kind *ErrorKind) New(data interface{}) error {
+	if kind.dataType != nil && reflect.TypeOf(data) != kind.dataType {
+		return errors.Annotate(ErrInternalError, "%s error data must be %s, got %T", kind.Name, kind.dataType, data)
+	}
+	err := &CodeError{Err: errors.NewErr("%s", kind.message(data)), Kind: kind, Data: data}
+	err.SetLocation(1)
+	return err
+}
+
+func (kind *ErrorKind) message(data interface{}) string {
+	if kind.template == nil {
+		return kind.Name
+	}
+	var buff bytes.Buffer
+	if err := kind.template.Execute(&buff, data); err != nil {
+		return kind.Name
+	}
+	return buff.String()
+}
+
+// CodeError 由 ErrorKind.New 构建,或者客户端根据响应错误码还原
+type CodeError struct {
+	errors.Err
+	Kind *ErrorKind
+	Data interface{}
+	// ErrorID 客户端还原时为响应中的 MessageError.ErrorID
+	ErrorID string
+}
+
+func (err *CodeError) RPCErrorCode() int64       { return err.Kind.Code }
+func (err *CodeError) RPCErrorMessage() string   { return err.Error() }
+func (err *CodeError) RPCErrorData() interface{} { return err.Data }
+func (err *CodeError) Is(target error) bool      { return target == error(err.Kind) }
+
+type errorKinds struct {
+	mu    sync.RWMutex
+	codes map[int64]*ErrorKind
+}
+
+var definedErrors = errorKinds{codes: make(map[int64]*ErrorKind)}
+
+// DefineError 声明命名错误码.
+// message 是 text/template 模版,使用错误数据渲染; data 是错误数据的原型值,决定客户端还原时的类型,可以为 nil.
+// 服务端和客户端应该声明相同的错误码. 错误码重复或模版无效时 panic
+func DefineError(code int64, name string, message string, data interface{}) *ErrorKind {
+	kind := &ErrorKind{Code: code, Name: name, dataType: reflect.TypeOf(data)}
+	if message != "" {
+		kind.template = template.Must(template.New(name).Option("missingkey=zero").Parse(message))
+	}
+
+	definedErrors.mu.Lock()
+	defer definedErrors.mu.Unlock()
+	if exist, ok := definedErrors.codes[code]; ok {
+		panic(fmt.Sprintf("rpc: error code %d already defined as %s", code, exist.Name))
+	}
+	definedErrors.codes[code] = kind
+	return kind
+}
+
+// LookupError 返回 code 对应的 ErrorKind.未声明时返回 nil
+func LookupError(code int64) *ErrorKind {
+	definedErrors.mu.RLock()
+	defer definedErrors.mu.RUnlock()
+	return definedErrors.codes[code]
+}
+
+// decodeError 将响应中的错误还原为 DefineError 声明的错误类型.
+// 编解码器保留未解码的错误数据, 声明了数据类型时解码为该类型, 否则解码为 interface{}.
+// 未声明的错误码或者错误数据无法解码时,返回原始的 MessageError
+func decodeError(codec ClientCodec, me *MessageError) error {
+	kind := LookupError(me.Code)
+	if kind == nil || kind.dataType == nil {
+		if raw, ok := rawErrorData(me.Data); ok {
+			var data interface{}
+			if err := codec.UnmarshalResponseResult(raw, &data); err == nil {
+				me.Data = data
+			}
+		}
+		if kind == nil {
+			return me
+		}
+	}
+
+	data := me.Data
+	if kind.dataType != nil && data != nil {
+		v := reflect.New(kind.dataType)
+		if raw, ok := rawErrorData(data); ok {
+			if err := codec.UnmarshalResponseResult(raw, v.Interface()); err != nil {
+				return me
+			}
+		} else if dv := reflect.ValueOf(data); dv.Type().AssignableTo(kind.dataType) {
+			v.Elem().Set(dv)
+		} else {
+			return me
+		}
+		data = v.Elem().Interface()
+	}
+
+	err := &CodeError{Err: errors.NewErr("%s", me.Message), Kind: kind, Data: data, ErrorID: me.ErrorID}
+	err.SetLocation(1)
+	return err
+}
+
+// rawErrorData 编解码器可以将未解码的错误数据保存为字节切片(如 json.RawMessage)
+func rawErrorData(data interface{}) (RawMessage, bool) {
+	if data == nil {
+		return nil, false
+	}
+	v := reflect.ValueOf(data)
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		return v.Bytes(), true
+	}
+	return nil, false
+}
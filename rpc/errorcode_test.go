@@ -0,0 +1,119 @@
+package rpc_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/smallsung/gopkg/errors"
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+	"github.com/smallsung/gopkg/rpc/msgpackrpc"
+)
+
+type insufficientBalance struct {
+	Need int64
+	Have int64
+}
+
+var errInsufficientBalance = rpc.DefineError(-32010, "InsufficientBalance", "insufficient balance: need {{.Need}}, have {{.Have}}", insufficientBalance{})
+
+type walletService struct{}
+
+func (walletService) Pay(amount int64) error {
+	return errInsufficientBalance.New(insufficientBalance{Need: amount, Have: 1})
+}
+
+// frozenError 的错误码没有通过 DefineError 声明
+type frozenError struct{}
+
+func (frozenError) Error() string               { return "account frozen" }
+func (frozenError) RPCErrorCode() int64         { return -32011 }
+func (frozenError) RPCErrorData() interface{}   { return map[string]interface{}{"reason": "audit"} }
+func (walletService) Refund(amount int64) error { return frozenError{} }
+
+// errAccountLocked 没有声明错误数据的类型
+var errAccountLocked = rpc.DefineError(-32012, "AccountLocked", "account locked", nil)
+
+func (walletService) Lock() error {
+	return errAccountLocked.New(map[string]interface{}{"reason": "audit"})
+}
+
+// Withdraw 错误数据的类型与声明的不一致
+func (walletService) Withdraw(amount int64) error {
+	return errInsufficientBalance.New(amount)
+}
+
+func TestUndefinedErrorData(t *testing.T) {
+	codecs := []struct {
+		server rpc.NewServerCodecFunc
+		client rpc.NewClientCodecFunc
+	}{
+		{jsonrpc.NewServerCodec, jsonrpc.NewClientCodec},
+		{msgpackrpc.NewServerCodec, msgpackrpc.NewClientCodec},
+	}
+	for _, codec := range codecs {
+		server := rpc.NewServer(codec.server)
+		if err := server.Register("wallet", walletService{}); err != nil {
+			t.Fatal(err)
+		}
+		client := rpc.DialInProc(context.Background(), server, codec.client)
+		err := client.Call(context.Background(), "wallet.refund", nil, 10)
+		me, ok := err.(*rpc.MessageError)
+		if !ok || me.Code != -32011 {
+			t.Fatalf("want *rpc.MessageError, got %#v", err)
+		}
+		if want := map[string]interface{}{"reason": "audit"}; !reflect.DeepEqual(me.Data, want) {
+			t.Fatalf("want data %#v, got %#v", want, me.Data)
+		}
+
+		// 声明的错误码没有数据类型时,数据同样解码为 interface{}
+		err = client.Call(context.Background(), "wallet.lock", nil)
+		var codeErr *rpc.CodeError
+		if !errors.Is(err, errAccountLocked) || !errors.As(err, &codeErr) {
+			t.Fatalf("want %v, got %#v", errAccountLocked, err)
+		}
+		if want := map[string]interface{}{"reason": "audit"}; !reflect.DeepEqual(codeErr.Data, want) {
+			t.Fatalf("want data %#v, got %#v", want, codeErr.Data)
+		}
+		client.Close()
+	}
+}
+
+func TestDefineError(t *testing.T) {
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("wallet", walletService{}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(context.Background(), server, jsonrpc.NewClientCodec)
+
+	err := client.Call(context.Background(), "wallet.pay", nil, 10)
+	if !errors.Is(err, errInsufficientBalance) {
+		t.Fatalf("want %v, got %#v", errInsufficientBalance, err)
+	}
+	var codeErr *rpc.CodeError
+	if !errors.As(err, &codeErr) {
+		t.Fatalf("want *rpc.CodeError, got %T", err)
+	}
+	if data, ok := codeErr.Data.(insufficientBalance); !ok || data.Need != 10 || data.Have != 1 {
+		t.Fatalf("unexpected data %#v", codeErr.Data)
+	}
+	if want := "insufficient balance: need 10, have 1"; codeErr.Error() != want {
+		t.Fatalf("want message %q, got %q", want, codeErr.Error())
+	}
+}
+
+func TestErrorKindDataMismatch(t *testing.T) {
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("wallet", walletService{}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(context.Background(), server, jsonrpc.NewClientCodec)
+	defer client.Close()
+
+	err := client.Call(context.Background(), "wallet.withdraw", nil, 10)
+	me, ok := err.(*rpc.MessageError)
+	if !ok || me.Code != -32603 || errors.Is(err, errInsufficientBalance) {
+		t.Fatalf("want internal error, got %#v", err)
+	}
+}
@@ -3,25 +3,33 @@ package rpc
 import (
 	"context"
 	"reflect"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/smallsung/gopkg/errors"
+	"go.uber.org/zap"
 )
 
 type handler struct {
-	codec    ServerCodec
-	registry *registry
+	server *Server
+	codec  ServerCodec
 }
 
 func (h *handler) handleMessages(ctx context.Context, requests *RequestMessages) *ResponseMessages {
 	responses := NewResponseMessages()
 	responses.Batch = requests.Batch
 	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
 	for _, r := range requests.Elems {
 		wg.Add(1)
 		request := r
 		go func() {
 			defer wg.Done()
 			if response := h.handleMessage(ctx, request); response != nil {
+				mu.Lock()
 				responses.Append(response)
+				mu.Unlock()
 			}
 
 		}()
@@ -31,6 +39,7 @@ func (h *handler) handleMessages(ctx context.Context, requests *RequestMessages)
 }
 
 func (h *handler) handleMessage(ctx context.Context, request *RequestMessage) *ResponseMessage {
+	ctx = context.WithValue(ctx, requestContextKey, request)
 	switch {
 	case request.IsNotification():
 		return h.handleNotification(ctx, request)
@@ -43,31 +52,75 @@ func (h *handler) handleMessage(ctx context.Context, request *RequestMessage) *R
 	}
 }
 
+// handleNotification 只执行内置 rpc 命名空间的通知(如 rpc.cancel), 其他通知被忽略.
+// 执行的过程与调用相同,但是没有响应. 错误只记录在日志中
 func (h *handler) handleNotification(ctx context.Context, request *RequestMessage) *ResponseMessage {
+	if h.server.notifications || strings.HasPrefix(request.Method, builtinServiceName+MethodSeparator) {
+		_ = h.handleCallBack(ctx, request)
+	}
 	return nil
 }
 
-func (h *handler) handleCallBack(ctx context.Context, request *RequestMessage) *ResponseMessage {
-	var cb *callback
-	if cb = h.registry.callback(request.Method); cb == nil {
+func (h *handler) handleCallBack(ctx context.Context, request *RequestMessage) (response *ResponseMessage) {
+	cb := h.server.registry.callback(request.Method, h.server.separator())
+
+	transport, method, start := PeerFromContext(ctx).Transport, request.Method, time.Now()
+	if cb == nil {
+		method = unknownMethod
+	}
+	h.server.Metrics.callStarted(transport)
+	defer func() { h.server.Metrics.callFinished(transport, method, start, response) }()
+
+	if cb == nil {
 		return request.ResponseError(ErrMethodNotFound)
 	}
 
 	var err error
 	var arguments []reflect.Value
 	if arguments, err = h.codec.UnmarshalRequestParams(request.Params, cb.ins); err != nil {
-		return request.ResponseError(ErrInvalidParams)
+		var argErr *ArgumentError
+		if !errors.As(err, &argErr) {
+			argErr = NewArgumentError(-1, nil, "%v", err)
+		}
+		return h.server.errorMessage(ctx, request, argErr)
+	}
+	if err = cb.validate(arguments); err != nil {
+		return h.server.errorMessage(ctx, request, err)
 	}
 
-	var result interface{}
-	if result, err = cb.call(ctx, arguments); err != nil {
-		return request.ResponseError(err)
+	if conn := ConnectionFromContext(ctx); conn != nil && !request.IsNotification() {
+		var finish func()
+		var ok bool
+		if ctx, finish, ok = conn.startCall(ctx, request.ID); !ok {
+			h.server.logger(ctx).Warn("server.duplicateId", zap.ByteString("id", request.ID), zap.String("method", request.Method))
+			return request.ResponseError(ErrInvalidRequest)
+		}
+		defer finish()
+	}
+
+	if cb.deprecated != "" {
+		h.server.logger(ctx).Warn("server.deprecated", zap.String("method", request.Method), zap.String("message", cb.deprecated))
+	}
+	if cb.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cb.timeout)
+		defer cancel()
+	}
 
+	var result interface{}
+	ctx, span := h.server.startCallbackSpan(ctx, request)
+	result, err = cb.call(ctx, arguments)
+	if err == nil && cb.outs.Stream {
+		result, err = h.server.drainStream(ctx, request, result)
+	}
+	span.Finish(err)
+	if err != nil {
+		return h.server.errorMessage(ctx, request, err)
 	}
 
 	var raw MessageResult
 	if raw, err = h.codec.MarshalResponseResult(result); err != nil {
-		return request.ResponseError(ErrInternalError)
+		return h.server.errorMessage(ctx, request, errors.Annotate(ErrInternalError, "codec.MarshalResponseResult: %v", err))
 	}
 
 	return request.ResponseResult(raw)
@@ -3,8 +3,11 @@ package rpc
 import (
 	"context"
 	"fmt"
+	"mime"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
 
 	"github.com/smallsung/gopkg/errors"
 )
@@ -41,7 +44,7 @@ type httpClientConn uintptr
 
 func (conn httpClientConn) Read(p []byte) (n int, err error)  { panic("implement me") }
 func (conn httpClientConn) Write(p []byte) (n int, err error) { panic("implement me") }
-func (conn httpClientConn) Close() error                      { panic("implement me") }
+func (conn httpClientConn) Close() error                      { return nil }
 
 type httpClientCodec struct {
 	ClientCodec
@@ -61,3 +64,88 @@ func DialHTTPWithClient(ctx context.Context, url *url.URL, newCodecFunc NewClien
 func DialHTTP(ctx context.Context, url *url.URL, newCodecFunc NewClientCodecFunc) *Client {
 	return DialHTTPWithClient(ctx, url, newCodecFunc, new(http.Client))
 }
+
+// RegisterCodec HTTP 请求的 Content-Type 为 mediaType 时使用 newCodecFunc.
+// 注册任意编解码器之后, ServeHTTP 只接受已注册的媒体类型与 MediaType,并且根据 Accept 拒绝无法返回的请求
+func (s *Server) RegisterCodec(mediaType string, newCodecFunc NewServerCodecFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.codecs == nil {
+		s.codecs = make(map[string]NewServerCodecFunc)
+	}
+	s.codecs[strings.ToLower(mediaType)] = newCodecFunc
+}
+
+// ContentTypes 返回 ServeHTTP 接受的媒体类型, MediaType 在最前面
+func (s *Server) ContentTypes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defaultMediaType := strings.ToLower(s.MediaType)
+	var mediaTypes []string
+	for mediaType := range s.codecs {
+		if mediaType != defaultMediaType {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+	}
+	sort.Strings(mediaTypes)
+	if defaultMediaType != "" {
+		mediaTypes = append([]string{defaultMediaType}, mediaTypes...)
+	}
+	return mediaTypes
+}
+
+func (s *Server) lookupCodec(mediaType string) (newCodecFunc NewServerCodecFunc, negotiate bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.codecs) == 0 {
+		return s.newCodec, false
+	}
+	if newCodecFunc, ok := s.codecs[mediaType]; ok {
+		return newCodecFunc, true
+	}
+	if mediaType != "" && mediaType == strings.ToLower(s.MediaType) {
+		return s.newCodec, true
+	}
+	return nil, true
+}
+
+// negotiate 选择请求使用的编解码器,失败时已经写入 HTTP 错误. 没有调用 RegisterCodec 时使用 NewServer 的编解码器
+func (s *Server) negotiate(response http.ResponseWriter, request *http.Request) (NewServerCodecFunc, bool) {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	newCodecFunc, negotiate := s.lookupCodec(mediaType)
+	if !negotiate {
+		return newCodecFunc, true
+	}
+
+	switch {
+	case request.Method != http.MethodPost:
+		http.Error(response, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	case err != nil || newCodecFunc == nil:
+		http.Error(response, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+	case !acceptable(request.Header.Values("Accept"), mediaType):
+		http.Error(response, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+	default:
+		response.Header().Set("Content-Type", mediaType)
+		return newCodecFunc, true
+	}
+	return nil, false
+}
+
+// acceptable 响应的媒体类型与请求的 Accept 相同,或者与 Accept 中的通配符匹配. 没有 Accept 时接受所有类型
+func acceptable(accepts []string, mediaType string) bool {
+	if len(accepts) == 0 {
+		return true
+	}
+	for _, accept := range accepts {
+		for _, v := range strings.Split(accept, ",") {
+			t, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+			if err != nil || params["q"] == "0" || params["q"] == "0.0" {
+				continue
+			}
+			if t == mediaType || t == "*/*" || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1])) {
+				return true
+			}
+		}
+	}
+	return false
+}
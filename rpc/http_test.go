@@ -0,0 +1,119 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+	"github.com/smallsung/gopkg/rpc/msgpackrpc"
+)
+
+type mathService struct{}
+
+func (mathService) Add(a, b int) int { return a + b }
+
+func TestHTTPContentNegotiation(t *testing.T) {
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	server.RegisterCodec(jsonrpc.ContentType, jsonrpc.NewServerCodec)
+	server.RegisterCodec(msgpackrpc.ContentType, msgpackrpc.NewHTTPServerCodec)
+	if err := server.Register("math", mathService{}); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+
+	for _, newCodec := range []rpc.NewClientCodecFunc{jsonrpc.NewClientCodec, msgpackrpc.NewClientCodec} {
+		client := rpc.DialHTTP(context.Background(), URL, newCodec)
+		var sum int
+		if err := client.Call(context.Background(), "math.add", &sum, 1, 2); err != nil {
+			t.Fatal(err)
+		}
+		if sum != 3 {
+			t.Fatalf("want 3, got %d", sum)
+		}
+	}
+
+	body := `{"jsonrpc":"2.0","id":1,"method":"math.add","params":[1,2]}`
+	for _, test := range []struct {
+		contentType, accept string
+		status              int
+	}{
+		{"application/json; charset=utf-8", "", http.StatusOK},
+		{"application/json", "application/*;q=0.5", http.StatusOK},
+		{"text/plain", "", http.StatusUnsupportedMediaType},
+		{"application/json", "application/msgpack", http.StatusNotAcceptable},
+	} {
+		request, _ := http.NewRequest(http.MethodPost, httpServer.URL, bytes.NewReader([]byte(body)))
+		request.Header.Set("Content-Type", test.contentType)
+		if test.accept != "" {
+			request.Header.Set("Accept", test.accept)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != test.status {
+			t.Fatalf("%s %s: want status %d, got %d", test.contentType, test.accept, test.status, response.StatusCode)
+		}
+	}
+}
+
+func TestHTTPDefaultCodecWithRegisteredCodec(t *testing.T) {
+	// 只注册了 MessagePack, NewServer 的 JSON 编解码器仍然可以使用
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	server.MediaType = jsonrpc.ContentType
+	server.RegisterCodec(msgpackrpc.ContentType, msgpackrpc.NewHTTPServerCodec)
+	if err := server.Register("math", mathService{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.ContentTypes(); len(got) != 2 || got[0] != jsonrpc.ContentType || got[1] != msgpackrpc.ContentType {
+		t.Fatalf("unexpected content types %v", got)
+	}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		jsonrpc.ValidHeader(server.ContentTypes()...).ServeHTTP(response, request)
+		server.ServeHTTP(response, request)
+	}))
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+
+	for _, newCodec := range []rpc.NewClientCodecFunc{jsonrpc.NewClientCodec, msgpackrpc.NewClientCodec} {
+		client := rpc.DialHTTP(context.Background(), URL, newCodec)
+		var sum int
+		if err := client.Call(context.Background(), "math.add", &sum, 1, 2); err != nil {
+			t.Fatal(err)
+		}
+		if sum != 3 {
+			t.Fatalf("want 3, got %d", sum)
+		}
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, httpServer.URL, bytes.NewReader([]byte("{}")))
+	request.Header.Set("Content-Type", "text/plain")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("want status %d, got %d", http.StatusUnsupportedMediaType, response.StatusCode)
+	}
+}
+
+// NewServer 不为了媒体类型创建编解码器
+func TestNewServerDoesNotCreateCodec(t *testing.T) {
+	server := rpc.NewServer(func(conn io.ReadWriteCloser) rpc.ServerCodec {
+		panic("codec created by NewServer")
+	})
+	server.MediaType = jsonrpc.ContentType
+	if got := server.ContentTypes(); len(got) != 1 || got[0] != jsonrpc.ContentType {
+		t.Fatalf("unexpected content types %v", got)
+	}
+}
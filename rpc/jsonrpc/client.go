@@ -4,34 +4,33 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"reflect"
+	"sync"
 
 	"github.com/smallsung/gopkg/rpc"
 )
 
 type clientCodec struct {
-	rwc     io.ReadWriteCloser
-	decoder *json.Decoder
+	rwc    io.ReadWriteCloser
+	framer Framer
+	// mu 双向调用时请求和响应可能同时写入
+	mu       sync.Mutex
+	config   Config
+	versions versions
 }
 
 func NewClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
-	return &clientCodec{rwc: conn, decoder: json.NewDecoder(conn)}
+	return Config{}.NewClientCodec(conn)
 }
 
 func (codec *clientCodec) WriteRequest(rawMessage rpc.RawMessage) error {
-	_, err := codec.rwc.Write(rawMessage)
-	return err
+	codec.mu.Lock()
+	defer codec.mu.Unlock()
+	return codec.framer.WriteFrame(rawMessage)
 }
 
 func (codec *clientCodec) MarshalRequest(requests *rpc.RequestMessages) (rpc.RawMessage, error) {
-	s := make([]*RequestMessage, 0, len(requests.Elems))
-	for _, m := range requests.Elems {
-		s = append(s, toRequestMessage(m))
-	}
-	if requests.Batch {
-		return json.Marshal(s)
-	} else {
-		return json.Marshal(s[0])
-	}
+	return marshalRequest(requests, codec.config.V1Compat)
 }
 
 func (codec *clientCodec) MarshalRequestParams(i ...interface{}) (rpc.MessageParams, error) {
@@ -39,7 +38,7 @@ func (codec *clientCodec) MarshalRequestParams(i ...interface{}) (rpc.MessagePar
 }
 
 func (codec *clientCodec) UnmarshalResponse(rawMessage rpc.RawMessage) (*rpc.ResponseMessages, error) {
-	if responses, err := parseResponseRawMessage(rawMessage); err != nil {
+	if responses, err := parseResponseRawMessage(rawMessage, codec.config.V1Compat); err != nil {
 		return nil, err
 	} else {
 		return responses, nil
@@ -51,17 +50,39 @@ func (codec *clientCodec) UnmarshalResponseResult(rawMessage rpc.MessageResult,
 }
 
 func (codec *clientCodec) ReadResponse() (rpc.RawMessage, error) {
-	var rawMessage json.RawMessage
-	if err := codec.decoder.Decode(&rawMessage); err != nil {
-		return nil, err
-	}
-	return rawMessage, nil
+	return codec.framer.ReadFrame()
+}
+
+func (codec *clientCodec) ContentType() string {
+	return ContentType
 }
 
 func (codec *clientCodec) Close() error {
 	return codec.rwc.Close()
 }
 
+func (codec *clientCodec) IsRequest(rawMessage rpc.RawMessage) bool {
+	return isRequestRawMessage(rawMessage)
+}
+
+func (codec *clientCodec) UnmarshalRequest(rawMessage rpc.RawMessage) (*rpc.RequestMessages, error) {
+	requests, v1, err := parseRequestRawMessage(rawMessage, codec.config.V1Compat)
+	codec.versions.add(v1)
+	return requests, err
+}
+
+func (codec *clientCodec) UnmarshalRequestParams(params rpc.MessageParams, ins rpc.Ins) ([]reflect.Value, error) {
+	return unmarshalRequestParams(params, ins)
+}
+
+func (codec *clientCodec) MarshalResponseResult(i interface{}) (rpc.MessageResult, error) {
+	return json.Marshal(i)
+}
+
+func (codec *clientCodec) MarshalResponse(responses *rpc.ResponseMessages) (rpc.RawMessage, error) {
+	return marshalResponse(responses, codec.versions.take)
+}
+
 type httpRoundTripperFunc func(request *http.Request) (*http.Response, error)
 
 func (f httpRoundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
@@ -75,8 +96,8 @@ var HttpRoundTripper = struct {
 }
 
 func validateResponseHeader(request *http.Request) (*http.Response, error) {
-	request.Header.Set("accept", contentType)
-	request.Header.Set("content-type", contentType)
+	request.Header.Set("accept", ContentType)
+	request.Header.Set("content-type", ContentType)
 	if response, err := http.DefaultTransport.RoundTrip(request); err != nil {
 		return response, err
 	} else {
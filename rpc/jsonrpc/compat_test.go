@@ -0,0 +1,56 @@
+package jsonrpc_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/smallsung/gopkg/errors"
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+type legacyService struct{}
+
+func (legacyService) Echo(s string) string { return s }
+
+func (legacyService) Fail(s string) error { return errors.New(s) }
+
+func TestV1Compat(t *testing.T) {
+	config := jsonrpc.Config{V1Compat: true}
+	server := rpc.NewServer(config.NewServerCodec)
+	if err := server.Register("legacy", legacyService{}); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Shutdown()
+
+	p1, p2 := net.Pipe()
+	go server.ServeConn(context.Background(), p1)
+	codec := config.NewClientCodec(p2)
+	for _, test := range []struct{ request, want string }{
+		{`{"id":1,"method":"legacy.echo","params":["a"]}`, `{"id":1,"result":"a","error":null}`},
+		{`{"jsonrpc":"2.0","id":2,"method":"legacy.echo","params":["b"]}`, `{"id":2,"jsonrpc":"2.0","result":"b"}`},
+	} {
+		if err := codec.WriteRequest([]byte(test.request)); err != nil {
+			t.Fatal(err)
+		}
+		raw, err := codec.ReadResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(raw) != test.want {
+			t.Fatalf("want %s, got %s", test.want, raw)
+		}
+	}
+
+	client := rpc.DialInProc(context.Background(), server, config.NewClientCodec)
+	defer client.Close()
+	var echo string
+	if err := client.Call(context.Background(), "legacy.echo", &echo, "c"); err != nil || echo != "c" {
+		t.Fatalf("want c, got %q %v", echo, err)
+	}
+	if err := client.Call(context.Background(), "legacy.fail", nil, "boom"); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("want error boom, got %v", err)
+	}
+}
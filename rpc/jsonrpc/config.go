@@ -0,0 +1,33 @@
+package jsonrpc
+
+import (
+	"io"
+
+	"github.com/smallsung/gopkg/rpc"
+)
+
+// Config 编解码器的配置. 零值与 NewServerCodec, NewClientCodec 相同:
+//
+//	rpc.NewServer(jsonrpc.Config{Framing: jsonrpc.HeaderFraming}.NewServerCodec)
+type Config struct {
+	// Framing 流式连接上消息的边界,默认 JSONFraming. HTTP 请求的消息边界由请求体确定,应该使用默认值
+	Framing Framing
+	// V1Compat 兼容 JSON-RPC 1.0: 服务端接受没有 jsonrpc 字段的请求,并以 1.0 的格式响应这些请求;
+	// 客户端发送 1.0 格式的请求,接受没有 jsonrpc 字段, error 为 null 或者 result 为 null 的响应
+	V1Compat bool
+}
+
+func (config Config) framing() Framing {
+	if config.Framing == nil {
+		return JSONFraming
+	}
+	return config.Framing
+}
+
+func (config Config) NewServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	return &serverCodec{rwc: conn, framer: config.framing()(conn), config: config}
+}
+
+func (config Config) NewClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
+	return &clientCodec{rwc: conn, framer: config.framing()(conn), config: config}
+}
@@ -0,0 +1,188 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/smallsung/gopkg/errors"
+)
+
+// Framer 在流式连接上读写完整的消息
+type Framer interface {
+	ReadFrame() (json.RawMessage, error)
+	WriteFrame(json.RawMessage) error
+}
+
+// Framing 创建连接的 Framer
+type Framing func(rw io.ReadWriter) Framer
+
+var (
+	// JSONFraming 由 json.Decoder 确定消息的边界,消息之间没有分隔符.
+	// 无法跳过错误的消息,读取失败后连接会被关闭
+	JSONFraming Framing = newJSONFramer
+	// HeaderFraming 每条消息之前是 Content-Length 头部,与 LSP 相同:
+	//	Content-Length: 52\r\n
+	//	\r\n
+	//	{"jsonrpc":"2.0","id":1,"method":"rpc.modules"}
+	HeaderFraming Framing = newHeaderFramer
+	// LineFraming 每行一条消息
+	LineFraming Framing = newLineFramer
+)
+
+// parseError 错误的消息已经被跳过,可以继续读取下一条消息
+type parseError struct {
+	errors.Err
+}
+
+func newParseError(format string, args ...interface{}) *parseError {
+	err := &parseError{Err: errors.NewErr(format, args...)}
+	err.SetLocation(1)
+	return err
+}
+
+func (err *parseError) Recoverable() bool { return true }
+
+type jsonFramer struct {
+	writer  io.Writer
+	decoder *json.Decoder
+}
+
+func newJSONFramer(rw io.ReadWriter) Framer {
+	return &jsonFramer{writer: rw, decoder: json.NewDecoder(rw)}
+}
+
+func (f *jsonFramer) ReadFrame() (json.RawMessage, error) {
+	var rawMessage json.RawMessage
+	if err := f.decoder.Decode(&rawMessage); err != nil {
+		return nil, err
+	}
+	return rawMessage, nil
+}
+
+func (f *jsonFramer) WriteFrame(rawMessage json.RawMessage) error {
+	_, err := f.writer.Write(rawMessage)
+	return err
+}
+
+const contentLengthHeader = "Content-Length"
+
+type headerFramer struct {
+	writer io.Writer
+	reader *bufio.Reader
+}
+
+func newHeaderFramer(rw io.ReadWriter) Framer {
+	return &headerFramer{writer: rw, reader: bufio.NewReader(rw)}
+}
+
+// ReadFrame 头部错误时跳过到下一个空行,消息不是有效的 JSON 时跳过整条消息
+func (f *headerFramer) ReadFrame() (json.RawMessage, error) {
+	length, headers := -1, 0
+	var headerErr error
+	for {
+		line, err := f.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if headers == 0 {
+				continue
+			}
+			break
+		}
+		headers++
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			headerErr = newParseError("invalid header line %q", line)
+			continue
+		}
+		if !strings.EqualFold(strings.TrimSpace(line[:i]), contentLengthHeader) {
+			continue
+		}
+		if length, err = strconv.Atoi(strings.TrimSpace(line[i+1:])); err != nil || length < 0 {
+			headerErr = newParseError("invalid %s %q", contentLengthHeader, line[i+1:])
+		}
+	}
+	switch {
+	case headerErr != nil:
+		return nil, headerErr
+	case length < 0:
+		return nil, newParseError("missing %s header", contentLengthHeader)
+	case length > maxRequestContentLength:
+		if _, err := io.CopyN(ioutil.Discard, f.reader, int64(length)); err != nil {
+			return nil, err
+		}
+		return nil, newParseError("message too large: %d bytes", length)
+	}
+
+	rawMessage := make(json.RawMessage, length)
+	if _, err := io.ReadFull(f.reader, rawMessage); err != nil {
+		return nil, err
+	}
+	if !json.Valid(rawMessage) {
+		return nil, newParseError("invalid message %q", rawMessage)
+	}
+	return rawMessage, nil
+}
+
+func (f *headerFramer) WriteFrame(rawMessage json.RawMessage) error {
+	frame := make([]byte, 0, len(contentLengthHeader)+16+len(rawMessage))
+	frame = append(frame, contentLengthHeader+": "...)
+	frame = strconv.AppendInt(frame, int64(len(rawMessage)), 10)
+	frame = append(frame, "\r\n\r\n"...)
+	_, err := f.writer.Write(append(frame, rawMessage...))
+	return err
+}
+
+type lineFramer struct {
+	writer io.Writer
+	reader *bufio.Reader
+}
+
+func newLineFramer(rw io.ReadWriter) Framer {
+	return &lineFramer{writer: rw, reader: bufio.NewReader(rw)}
+}
+
+// ReadFrame 忽略空行,跳过不是有效 JSON 的行
+func (f *lineFramer) ReadFrame() (json.RawMessage, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := f.reader.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line)+len(chunk) > maxRequestContentLength {
+			for isPrefix && err == nil {
+				_, isPrefix, err = f.reader.ReadLine()
+			}
+			if err != nil {
+				return nil, err
+			}
+			return nil, newParseError("message too large")
+		}
+		line = append(line, chunk...)
+		if isPrefix {
+			continue
+		}
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		break
+	}
+	if !json.Valid(line) {
+		return nil, newParseError("invalid message %q", line)
+	}
+	return line, nil
+}
+
+// WriteFrame json.Marshal 的结果不包含换行
+func (f *lineFramer) WriteFrame(rawMessage json.RawMessage) error {
+	_, err := f.writer.Write(append(rawMessage[:len(rawMessage):len(rawMessage)], '\n'))
+	return err
+}
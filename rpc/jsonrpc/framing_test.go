@@ -0,0 +1,58 @@
+package jsonrpc_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+type echoService struct{}
+
+func (echoService) Echo(s string) string { return s }
+
+func TestFramingResynchronize(t *testing.T) {
+	valid := `{"jsonrpc":"2.0","id":1,"method":"e.echo","params":["a"]}`
+	tests := map[string]struct {
+		framing jsonrpc.Framing
+		input   string
+	}{
+		"header": {
+			framing: jsonrpc.HeaderFraming,
+			input: "Content-Length: 5\r\n\r\n{bad}" +
+				"garbage\r\n\r\n" +
+				"Content-Length: " + strconv.Itoa(len(valid)) + "\r\n\r\n" + valid,
+		},
+		"line": {
+			framing: jsonrpc.LineFraming,
+			input:   "{bad}\n\nnot json\n" + valid + "\n",
+		},
+	}
+
+	for name, test := range tests {
+		config := jsonrpc.Config{Framing: test.framing}
+		server := rpc.NewServer(config.NewServerCodec)
+		if err := server.Register("e", echoService{}); err != nil {
+			t.Fatal(err)
+		}
+		p1, p2 := net.Pipe()
+		go server.ServeConn(context.Background(), p1)
+		go func(input string) { _, _ = p2.Write([]byte(input)) }(test.input)
+
+		codec := config.NewClientCodec(p2)
+		for i, want := range []string{`"code":-32700`, `"code":-32700`, `"result":"a"`} {
+			raw, err := codec.ReadResponse()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if !strings.Contains(string(raw), want) {
+				t.Fatalf("%s: response %d: want %s, got %s", name, i, want, raw)
+			}
+		}
+		server.Shutdown()
+	}
+}
@@ -5,17 +5,53 @@ import (
 	"encoding/json"
 	"io"
 	"reflect"
+	"sync"
 
 	"github.com/smallsung/gopkg/errors"
 	"github.com/smallsung/gopkg/rpc"
 )
 
-const defaultJsonRpcVersion = "2.0"
+const (
+	defaultJsonRpcVersion = "2.0"
+	v1JsonRpcVersion      = "1.0"
+	// v1ErrorCode 1.0 的错误可以是任意值,没有错误码时使用
+	v1ErrorCode = -32000
+)
+
+// validVersion 兼容 1.0 时,没有 jsonrpc 字段的消息是 1.0 的消息
+func validVersion(version string, compat bool) bool {
+	return version == defaultJsonRpcVersion || (compat && (version == "" || version == v1JsonRpcVersion))
+}
 
 type MessageError struct {
 	Code    int64       `json:"code"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
+	ErrorID string      `json:"errorId,omitempty"`
+}
+
+// UnmarshalJSON 保留未解码的 data, 由 rpc.Client 根据错误码还原
+func (me *MessageError) UnmarshalJSON(rawMessage []byte) error {
+	var v struct {
+		Code    int64           `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+		ErrorID string          `json:"errorId"`
+	}
+	// 1.0 的错误可能只是一个字符串
+	var message string
+	if err := json.Unmarshal(rawMessage, &message); err == nil {
+		me.Code, me.Message, me.Data = v1ErrorCode, message, nil
+		return nil
+	}
+	if err := json.Unmarshal(rawMessage, &v); err != nil {
+		return err
+	}
+	me.Code, me.Message, me.Data, me.ErrorID = v.Code, v.Message, nil, v.ErrorID
+	if len(v.Data) > 0 && string(v.Data) != string(null) {
+		me.Data = v.Data
+	}
+	return nil
 }
 
 type RequestMessage struct {
@@ -23,6 +59,8 @@ type RequestMessage struct {
 	Version string          `json:"jsonrpc"`
 	Method  string          `json:"method,omitempty"`
 	Params  json.RawMessage `json:"params,omitempty"`
+
+	TraceParent string `json:"traceparent,omitempty"`
 }
 
 type ResponseMessage struct {
@@ -32,23 +70,92 @@ type ResponseMessage struct {
 	Error   *MessageError   `json:"error,omitempty"`
 }
 
+// v1RequestMessage 1.0 的通知 id 为 null
+type v1RequestMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// v1ResponseMessage 1.0 的响应同时包含 result 和 error, 其中一个为 null
+type v1ResponseMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *MessageError   `json:"error"`
+}
+
 var null = json.RawMessage("null")
 
+// versions 记录 1.0 请求的ID, 响应时以相同的版本编码
+type versions struct {
+	mu sync.Mutex
+	v1 map[string]struct{}
+}
+
+func (vs *versions) add(ids []rpc.MessageID) {
+	if len(ids) == 0 {
+		return
+	}
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if vs.v1 == nil {
+		vs.v1 = make(map[string]struct{})
+	}
+	for _, id := range ids {
+		vs.v1[string(id)] = struct{}{}
+	}
+}
+
+func (vs *versions) take(id rpc.MessageID) bool {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	_, ok := vs.v1[string(id)]
+	delete(vs.v1, string(id))
+	return ok
+}
+
 func toRPCRequestMessage(request *RequestMessage) *rpc.RequestMessage {
 	return &rpc.RequestMessage{
-		ID:     request.ID,
-		Method: request.Method,
-		Params: request.Params,
+		ID:          request.ID,
+		Method:      request.Method,
+		Params:      request.Params,
+		TraceParent: request.TraceParent,
 	}
 }
 
 func toRequestMessage(request *rpc.RequestMessage) *RequestMessage {
 	return &RequestMessage{
-		ID:      request.ID,
-		Version: defaultJsonRpcVersion,
-		Method:  request.Method,
-		Params:  request.Params,
+		ID:          request.ID,
+		Version:     defaultJsonRpcVersion,
+		Method:      request.Method,
+		Params:      request.Params,
+		TraceParent: request.TraceParent,
+	}
+}
+
+func toV1RequestMessage(request *rpc.RequestMessage) *v1RequestMessage {
+	to := &v1RequestMessage{ID: request.ID, Method: request.Method, Params: request.Params}
+	if to.ID == nil {
+		to.ID = null
+	}
+	if to.Params == nil {
+		to.Params = json.RawMessage("[]")
+	}
+	return to
+}
+
+func toV1ResponseMessage(response *rpc.ResponseMessage) *v1ResponseMessage {
+	to := &v1ResponseMessage{ID: response.ID, Result: response.Result}
+	if response.Error != nil {
+		to.Result = nil
+		to.Error = &MessageError{
+			Code:    response.Error.Code,
+			Message: response.Error.Message,
+			Data:    response.Error.Data,
+			ErrorID: response.Error.ErrorID,
+		}
 	}
+	return to
 }
 
 func toResponseMessage(response *rpc.ResponseMessage) *ResponseMessage {
@@ -62,6 +169,7 @@ func toResponseMessage(response *rpc.ResponseMessage) *ResponseMessage {
 			Code:    response.Error.Code,
 			Message: response.Error.Message,
 			Data:    response.Error.Data,
+			ErrorID: response.Error.ErrorID,
 		}
 	}
 	return to
@@ -77,6 +185,7 @@ func toRPCResponseMessage(response *ResponseMessage) *rpc.ResponseMessage {
 			Code:    response.Error.Code,
 			Message: response.Error.Message,
 			Data:    response.Error.Data,
+			ErrorID: response.Error.ErrorID,
 		}
 	}
 	return to
@@ -148,17 +257,20 @@ func toRPCResponseMessage(response *ResponseMessage) *rpc.ResponseMessage {
 //	    {"rpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null},
 //	    {"rpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}
 //	    ]
-func parseRequestRawMessage(rawMessage json.RawMessage) (*rpc.RequestMessages, error) {
-	requests := rpc.NewRequestMessages()
+//兼容 1.0 时 v1 是其中 1.0 请求的ID
+func parseRequestRawMessage(rawMessage json.RawMessage, compat bool) (requests *rpc.RequestMessages, v1 []rpc.MessageID, err error) {
+	requests = rpc.NewRequestMessages()
+	var versions []string
 	if !isArrayRawMessage(rawMessage) {
 		var v RequestMessage
 		if err := json.Unmarshal(rawMessage, &v); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		if v.Version != defaultJsonRpcVersion {
-			return nil, rpc.ErrInvalidRequest
+		if !validVersion(v.Version, compat) {
+			return nil, nil, rpc.ErrInvalidRequest
 		}
 		requests.Append(toRPCRequestMessage(&v))
+		versions = append(versions, v.Version)
 	} else {
 		decoder := json.NewDecoder(bytes.NewReader(rawMessage))
 		_, _ = decoder.Token() // skip '['
@@ -166,13 +278,16 @@ func parseRequestRawMessage(rawMessage json.RawMessage) (*rpc.RequestMessages, e
 			var v RequestMessage
 			if err := decoder.Decode(&v); err != nil {
 				requests.Append(new(rpc.RequestMessage))
+				versions = append(versions, "")
 				continue
 			}
-			if v.Version != defaultJsonRpcVersion {
+			if !validVersion(v.Version, compat) {
 				requests.Append(new(rpc.RequestMessage))
+				versions = append(versions, "")
 				continue
 			}
 			requests.Append(toRPCRequestMessage(&v))
+			versions = append(versions, v.Version)
 		}
 		requests.Batch = true
 	}
@@ -181,19 +296,22 @@ func parseRequestRawMessage(rawMessage json.RawMessage) (*rpc.RequestMessages, e
 		if string(message.ID) == string(null) {
 			requests.Elems[i].ID = nil
 		}
+		if versions[i] != defaultJsonRpcVersion && requests.Elems[i].ID != nil {
+			v1 = append(v1, requests.Elems[i].ID)
+		}
 	}
 
-	return requests, nil
+	return requests, v1, nil
 }
 
-func parseResponseRawMessage(rawMessage json.RawMessage) (*rpc.ResponseMessages, error) {
+func parseResponseRawMessage(rawMessage json.RawMessage, compat bool) (*rpc.ResponseMessages, error) {
 	responses := rpc.NewResponseMessages()
 	if !isArrayRawMessage(rawMessage) {
 		var v ResponseMessage
 		if err := json.Unmarshal(rawMessage, &v); err != nil {
 			return nil, err
 		}
-		if v.Version != defaultJsonRpcVersion {
+		if !validVersion(v.Version, compat) {
 			return nil, rpc.ErrInvalidRequest
 		}
 		responses.Append(toRPCResponseMessage(&v))
@@ -206,7 +324,7 @@ func parseResponseRawMessage(rawMessage json.RawMessage) (*rpc.ResponseMessages,
 				responses.Append(new(rpc.ResponseMessage))
 				continue
 			}
-			if v.Version != defaultJsonRpcVersion {
+			if !validVersion(v.Version, compat) {
 				responses.Append(new(rpc.ResponseMessage))
 				continue
 			}
@@ -219,11 +337,121 @@ func parseResponseRawMessage(rawMessage json.RawMessage) (*rpc.ResponseMessages,
 		if string(message.ID) == string(null) {
 			responses.Elems[i].ID = nil
 		}
+		// 1.0 的错误响应 result 为 null
+		if compat && message.Error != nil && string(message.Result) == string(null) {
+			responses.Elems[i].Result = nil
+		}
 	}
 
 	return responses, nil
 }
 
+// marshalRequest v1 为 true 时使用 1.0 的格式
+func marshalRequest(requests *rpc.RequestMessages, v1 bool) (json.RawMessage, error) {
+	s := make([]interface{}, 0, len(requests.Elems))
+	for _, m := range requests.Elems {
+		if v1 {
+			s = append(s, toV1RequestMessage(m))
+		} else {
+			s = append(s, toRequestMessage(m))
+		}
+	}
+	if requests.Batch {
+		return json.Marshal(s)
+	} else {
+		return json.Marshal(s[0])
+	}
+}
+
+// marshalResponse v1 返回 true 的ID使用 1.0 的格式
+func marshalResponse(responses *rpc.ResponseMessages, v1 func(id rpc.MessageID) bool) (json.RawMessage, error) {
+	s := make([]interface{}, 0, len(responses.Elems))
+	for _, m := range responses.Elems {
+		if m.ID == nil {
+			m.ID = null
+		}
+		if v1(m.ID) {
+			s = append(s, toV1ResponseMessage(m))
+		} else {
+			s = append(s, toResponseMessage(m))
+		}
+	}
+	if responses.Batch {
+		return json.Marshal(s)
+	} else {
+		return json.Marshal(s[0])
+	}
+}
+
+func unmarshalRequestParams(params rpc.MessageParams, ins rpc.Ins) ([]reflect.Value, error) {
+	//not Supported by-name. 省略 params 与空数组相同
+	if len(bytes.TrimSpace(params)) != 0 && !isArrayRawMessage(params) {
+		return nil, rpc.NewArgumentError(-1, nil, "params must be an array")
+	}
+	return parsePositionalArguments(params, ins)
+}
+
+// messageKind 只扫描字段名,不解码字段的值. 批处理消息以第一个元素为准.
+// 先遇到 method 的消息是请求或者通知,先遇到 result 或者 error 的消息是响应
+func messageKind(rawMessage json.RawMessage) (request, response bool) {
+	decoder := json.NewDecoder(bytes.NewReader(rawMessage))
+	token, err := decoder.Token()
+	if token == json.Delim('[') {
+		token, err = decoder.Token()
+	}
+	if err != nil || token != json.Delim('{') {
+		return false, false
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return false, false
+		}
+		switch key {
+		case "method":
+			return true, false
+		case "result", "error":
+			return false, true
+		}
+		if err := skipValue(decoder); err != nil {
+			return false, false
+		}
+	}
+	return false, false
+}
+
+// skipValue 跳过下一个值
+func skipValue(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// isRequestRawMessage 包含 method 的消息是请求或者通知
+func isRequestRawMessage(rawMessage json.RawMessage) bool {
+	request, _ := messageKind(rawMessage)
+	return request
+}
+
+// isResponseRawMessage 没有 method 并且包含 result 或者 error 的消息是响应
+func isResponseRawMessage(rawMessage json.RawMessage) bool {
+	_, response := messageKind(rawMessage)
+	return response
+}
+
 // isArrayRawMessage 当第一个非空白字符是 [ 时 rawMessage 是批处理消息
 func isArrayRawMessage(bytes []byte) bool {
 	for _, c := range bytes {
@@ -236,44 +464,45 @@ func isArrayRawMessage(bytes []byte) bool {
 	return false
 }
 
-func parsePositionalArguments(params rpc.MessageParams, types []reflect.Type) ([]reflect.Value, error) {
+func parsePositionalArguments(params rpc.MessageParams, ins rpc.Ins) ([]reflect.Value, error) {
 	decoder := json.NewDecoder(bytes.NewReader(params))
 	var args []reflect.Value
 	token, err := decoder.Token()
 	switch {
 	case err == io.EOF:
 	case err != nil:
-		return nil, errors.Trace(err)
+		return nil, rpc.NewArgumentError(-1, nil, "%v", err)
 	case token == json.Delim('['):
-		if args, err = parseArgumentArray(decoder, types); err != nil {
-			return nil, errors.Trace(err)
+		if args, err = parseArgumentArray(decoder, ins); err != nil {
+			return nil, err
 		}
 	default:
-		return nil, errors.New("params MUST be an Array, containing the values in the Server expected order.")
+		return nil, rpc.NewArgumentError(-1, nil, "params MUST be an Array, containing the values in the Server expected order.")
 	}
 	//Set any missing args to nil.
-	for i := len(args); i < len(types); i++ {
+	for i := len(args); i < ins.NumFixed(); i++ {
 		// todo go-ethereum 中这个地方对非指针变量有限制，还不明白这么做的意义
-		switch types[i].Kind() {
+		switch ins.Position[i].Kind() {
 		case reflect.Ptr, reflect.Interface:
 		default:
-			return nil, errors.Format("missing value for required argument %d", i)
+			return nil, rpc.NewArgumentError(i, ins.Position[i], "missing value for required argument")
 		}
-		args = append(args, reflect.Zero(types[i]))
+		args = append(args, reflect.Zero(ins.Position[i]))
 	}
 	return args, nil
 }
 
-func parseArgumentArray(decoder *json.Decoder, types []reflect.Type) ([]reflect.Value, error) {
-	quantity := len(types)
-	args := make([]reflect.Value, 0, quantity)
+// parseArgumentArray 可变参数的每个元素作为单独的参数返回
+func parseArgumentArray(decoder *json.Decoder, ins rpc.Ins) ([]reflect.Value, error) {
+	args := make([]reflect.Value, 0, len(ins.Position))
 	for i := 0; decoder.More(); i++ {
-		if i >= quantity {
-			return nil, errors.Format("too many arguments, want at most %d", len(types))
+		typ, ok := ins.ArgumentType(i)
+		if !ok {
+			return nil, rpc.NewArgumentError(i, nil, "too many arguments, want at most %d", len(ins.Position))
 		}
-		val := reflect.New(types[i])
+		val := reflect.New(typ)
 		if err := decoder.Decode(val.Interface()); err != nil {
-			return nil, errors.Trace(err)
+			return nil, rpc.NewArgumentError(i, typ, "%v", err)
 		}
 		//if val.IsNil() && val.Kind() != reflect.Ptr {
 		//	return args, errors.Errorf("missing value for required argument %d", i)
@@ -7,41 +7,41 @@ import (
 	"mime"
 	"net/http"
 	"reflect"
+	"strings"
+	"sync"
 
 	"github.com/smallsung/gopkg/rpc"
 )
 
 type serverCodec struct {
-	rwc     io.ReadWriteCloser
-	decoder *json.Decoder
+	rwc    io.ReadWriteCloser
+	framer Framer
+	// mu 双向调用时请求和响应可能同时写入
+	mu     sync.Mutex
+	config Config
+	// versions 1.0 请求的ID, 以相同的版本响应
+	versions versions
 }
 
 func NewServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
-	return &serverCodec{rwc: conn, decoder: json.NewDecoder(conn)}
+	return Config{}.NewServerCodec(conn)
 }
 
 func (codec *serverCodec) ReadRequest() (rpc.RawMessage, error) {
-	var rawMessage json.RawMessage
-	if err := codec.decoder.Decode(&rawMessage); err != nil {
-		return nil, err
-	}
-	return rawMessage, nil
+	return codec.framer.ReadFrame()
 }
 
 func (codec *serverCodec) UnmarshalRequest(rawMessage rpc.RawMessage) (*rpc.RequestMessages, error) {
-	if requests, err := parseRequestRawMessage(rawMessage); err != nil {
+	if requests, v1, err := parseRequestRawMessage(rawMessage, codec.config.V1Compat); err != nil {
 		return nil, err
 	} else {
+		codec.versions.add(v1)
 		return requests, nil
 	}
 }
 
 func (codec *serverCodec) UnmarshalRequestParams(params rpc.MessageParams, ins rpc.Ins) ([]reflect.Value, error) {
-	//not Supported by-name
-	if !isArrayRawMessage(params) {
-		return nil, rpc.ErrInvalidParams
-	}
-	return parsePositionalArguments(params, ins.Position)
+	return unmarshalRequestParams(params, ins)
 }
 
 func (codec *serverCodec) MarshalResponseResult(i interface{}) (rpc.MessageResult, error) {
@@ -49,23 +49,37 @@ func (codec *serverCodec) MarshalResponseResult(i interface{}) (rpc.MessageResul
 }
 
 func (codec *serverCodec) MarshalResponse(responses *rpc.ResponseMessages) (rpc.RawMessage, error) {
-	s := make([]*ResponseMessage, 0, len(responses.Elems))
-	for _, m := range responses.Elems {
-		if m.ID == nil {
-			m.ID = null
-		}
-		s = append(s, toResponseMessage(m))
-	}
-	if responses.Batch {
-		return json.Marshal(s)
-	} else {
-		return json.Marshal(s[0])
-	}
+	return marshalResponse(responses, codec.versions.take)
 }
 
 func (codec *serverCodec) WriteResponse(rawMessage rpc.RawMessage) error {
-	_, err := codec.rwc.Write(rawMessage)
-	return err
+	codec.mu.Lock()
+	defer codec.mu.Unlock()
+	return codec.framer.WriteFrame(rawMessage)
+}
+
+func (codec *serverCodec) IsResponse(rawMessage rpc.RawMessage) bool {
+	return isResponseRawMessage(rawMessage)
+}
+
+func (codec *serverCodec) MarshalRequestParams(i ...interface{}) (rpc.MessageParams, error) {
+	return json.Marshal(i)
+}
+
+func (codec *serverCodec) MarshalRequest(requests *rpc.RequestMessages) (rpc.RawMessage, error) {
+	return marshalRequest(requests, false)
+}
+
+func (codec *serverCodec) UnmarshalResponse(rawMessage rpc.RawMessage) (*rpc.ResponseMessages, error) {
+	return parseResponseRawMessage(rawMessage, codec.config.V1Compat)
+}
+
+func (codec *serverCodec) UnmarshalResponseResult(rawMessage rpc.MessageResult, i interface{}) error {
+	return json.Unmarshal(rawMessage, i)
+}
+
+func (codec *serverCodec) ContentType() string {
+	return ContentType
 }
 
 func (codec *serverCodec) Close() error {
@@ -73,21 +87,27 @@ func (codec *serverCodec) Close() error {
 }
 
 const (
-	contentType             = "application/json"
+	// ContentType HTTP 请求和响应的媒体类型, 用于 rpc.Server.RegisterCodec
+	ContentType             = "application/json"
 	maxRequestContentLength = 1024 * 1024 * 5
 )
 
-var (
-	acceptedContentTypes = []string{contentType}
-)
-
+// HttpHandlers.ValidHeader 只接受 ContentType
 var HttpHandlers = struct {
 	ValidHeader http.Handler
 }{
-	ValidHeader: http.HandlerFunc(validateRequestHeader),
+	ValidHeader: ValidHeader(ContentType),
+}
+
+// ValidHeader 检查 HTTP 请求的方法,长度与 Content-Type, 只接受 contentTypes 中的媒体类型.
+// 与注册了多个编解码器的 rpc.Server 一起使用时传入 Server.ContentTypes()
+func ValidHeader(contentTypes ...string) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		validateRequestHeader(response, request, contentTypes)
+	})
 }
 
-func validateRequestHeader(response http.ResponseWriter, request *http.Request) {
+func validateRequestHeader(response http.ResponseWriter, request *http.Request, contentTypes []string) {
 	cancel := true
 	ctx, cancelFunc := context.WithCancel(request.Context())
 	defer func() {
@@ -117,8 +137,8 @@ func validateRequestHeader(response http.ResponseWriter, request *http.Request)
 		return
 	}
 	var flag bool
-	for _, accepted := range acceptedContentTypes {
-		if accepted == mediaType {
+	for _, accepted := range contentTypes {
+		if strings.EqualFold(accepted, mediaType) {
 			flag = true
 		}
 	}
@@ -127,6 +147,6 @@ func validateRequestHeader(response http.ResponseWriter, request *http.Request)
 		return
 	}
 
-	response.Header().Set("content-type", contentType)
+	response.Header().Set("content-type", mediaType)
 	cancel = false
 }
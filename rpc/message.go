@@ -1,6 +1,10 @@
 package rpc
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 
 	"github.com/smallsung/gopkg/errors"
@@ -35,17 +39,16 @@ func (rm *ResponseMessage) HasValidID() bool {
 	return len(rm.ID) > 0 && rm.ID[0] != '{' && rm.ID[0] != '['
 }
 
-var debugErrorOnClient bool
-
-func EnableDebugErrorOnClient() {
-	debugErrorOnClient = true
-}
-
 const defaultErrorCode = -32000
 
 func errorResponseMessage(err error) *ResponseMessage {
+	return &ResponseMessage{ID: nil, Error: newMessageError(err, false)}
+}
+
+// newMessageError debug 为 true 时 Message 包含完整的错误链(文件,行号,PC)
+func newMessageError(err error, debug bool) *MessageError {
 	me := &MessageError{Code: defaultErrorCode}
-	if debugErrorOnClient {
+	if debug {
 		me.Message = fmt.Sprintf("%+v", err)
 	} else {
 		var em ErrorMessage
@@ -64,7 +67,39 @@ func errorResponseMessage(err error) *ResponseMessage {
 	if errors.As(err, &ed) {
 		me.Data = ed.RPCErrorData()
 	}
-	return &ResponseMessage{ID: nil, Error: me}
+	return me
+}
+
+// decodeMessageID 将请求ID还原为可以由任意编解码器编码的值
+func decodeMessageID(id MessageID) interface{} {
+	decoder := json.NewDecoder(bytes.NewReader(id))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil
+	}
+	if n, ok := v.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+		f, _ := n.Float64()
+		return f
+	}
+	return v
+}
+
+// encodeMessageID decodeMessageID 的逆过程. 数值在不同的编解码器之间可能变为 float64 或者其他整数类型
+func encodeMessageID(v interface{}) (MessageID, error) {
+	if f, ok := v.(float64); ok && f == float64(int64(f)) {
+		v = int64(f)
+	}
+	return json.Marshal(v)
+}
+
+func newCorrelationID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
 }
 
 func NewRequestMessages(messages ...*RequestMessage) *RequestMessages {
@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/smallsung/gopkg/metrics"
+)
+
+// unknownMethod 未注册的方法统一使用该标签值,避免客户端制造无限的标签
+const unknownMethod = "unknown"
+
+// ServerMetrics rpc.Server 的监控指标.多个 Server 可以共用
+type ServerMetrics struct {
+	calls       *metrics.CounterVec
+	errors      *metrics.CounterVec
+	latency     *metrics.HistogramVec
+	inflight    *metrics.GaugeVec
+	batchSize   *metrics.HistogramVec
+	connections *metrics.GaugeVec
+}
+
+func NewServerMetrics(registry *metrics.Registry) *ServerMetrics {
+	return &ServerMetrics{
+		calls:       registry.NewCounterVec("rpc_server_calls_total", "Total number of rpc calls.", "transport", "method"),
+		errors:      registry.NewCounterVec("rpc_server_errors_total", "Total number of rpc calls that returned an error.", "transport", "method", "code"),
+		latency:     registry.NewHistogramVec("rpc_server_call_duration_seconds", "Latency of rpc calls.", nil, "transport", "method"),
+		inflight:    registry.NewGaugeVec("rpc_server_inflight_calls", "Number of rpc calls being processed.", "transport"),
+		batchSize:   registry.NewHistogramVec("rpc_server_batch_size", "Number of requests in rpc batches.", []float64{1, 2, 5, 10, 20, 50, 100}, "transport"),
+		connections: registry.NewGaugeVec("rpc_server_connections", "Number of open stream connections.", "transport"),
+	}
+}
+
+func (m *ServerMetrics) callStarted(transport string) {
+	if m == nil {
+		return
+	}
+	m.inflight.With(transport).Inc()
+}
+
+// callFinished response 为 nil 时表示通知
+func (m *ServerMetrics) callFinished(transport, method string, start time.Time, response *ResponseMessage) {
+	if m == nil {
+		return
+	}
+	m.inflight.With(transport).Dec()
+	m.calls.With(transport, method).Inc()
+	m.latency.With(transport, method).Observe(time.Since(start).Seconds())
+	if response != nil && response.Error != nil {
+		m.errors.With(transport, method, strconv.FormatInt(response.Error.Code, 10)).Inc()
+	}
+}
+
+func (m *ServerMetrics) batch(transport string, size int) {
+	if m == nil {
+		return
+	}
+	m.batchSize.With(transport).Observe(float64(size))
+}
+
+func (m *ServerMetrics) connectionOpened(transport string) {
+	if m == nil {
+		return
+	}
+	m.connections.With(transport).Inc()
+}
+
+func (m *ServerMetrics) connectionClosed(transport string) {
+	if m == nil {
+		return
+	}
+	m.connections.With(transport).Dec()
+}
+
+// ClientMetrics rpc.Client 的监控指标.多个 Client 可以共用
+type ClientMetrics struct {
+	calls    *metrics.CounterVec
+	pending  *metrics.GaugeVec
+	timeouts *metrics.CounterVec
+}
+
+func NewClientMetrics(registry *metrics.Registry) *ClientMetrics {
+	return &ClientMetrics{
+		calls:    registry.NewCounterVec("rpc_client_calls_total", "Total number of rpc calls sent.", "method"),
+		pending:  registry.NewGaugeVec("rpc_client_pending_calls", "Number of rpc calls waiting for a response."),
+		timeouts: registry.NewCounterVec("rpc_client_timeouts_total", "Total number of rpc calls abandoned because the context was done.", "method"),
+	}
+}
+
+func (m *ClientMetrics) sent(requests *RequestMessages) {
+	if m == nil {
+		return
+	}
+	for _, request := range requests.Elems {
+		m.calls.With(request.Method).Inc()
+	}
+}
+
+func (m *ClientMetrics) pendingAdd(delta int) {
+	if m == nil {
+		return
+	}
+	m.pending.With().Add(float64(delta))
+}
+
+func (m *ClientMetrics) timeout(requests *RequestMessages) {
+	if m == nil {
+		return
+	}
+	for _, request := range requests.Elems {
+		m.timeouts.With(request.Method).Inc()
+	}
+}
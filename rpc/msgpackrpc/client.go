@@ -0,0 +1,74 @@
+package msgpackrpc
+
+import (
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/smallsung/gopkg/rpc"
+)
+
+type clientCodec struct {
+	rwc    io.ReadWriteCloser
+	framer Framer
+	// mu 双向调用时请求和响应可能同时写入
+	mu sync.Mutex
+}
+
+func NewClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
+	return Config{}.NewClientCodec(conn)
+}
+
+func (codec *clientCodec) WriteRequest(rawMessage rpc.RawMessage) error {
+	codec.mu.Lock()
+	defer codec.mu.Unlock()
+	return codec.framer.WriteFrame(rawMessage)
+}
+
+func (codec *clientCodec) MarshalRequest(requests *rpc.RequestMessages) (rpc.RawMessage, error) {
+	return marshalRequest(requests)
+}
+
+func (codec *clientCodec) MarshalRequestParams(i ...interface{}) (rpc.MessageParams, error) {
+	return marshal(i)
+}
+
+func (codec *clientCodec) UnmarshalResponse(rawMessage rpc.RawMessage) (*rpc.ResponseMessages, error) {
+	return parseResponseRawMessage(rawMessage)
+}
+
+func (codec *clientCodec) UnmarshalResponseResult(rawMessage rpc.MessageResult, i interface{}) error {
+	return unmarshal(rawMessage, i)
+}
+
+func (codec *clientCodec) ReadResponse() (rpc.RawMessage, error) {
+	return codec.framer.ReadFrame()
+}
+
+func (codec *clientCodec) ContentType() string {
+	return ContentType
+}
+
+func (codec *clientCodec) Close() error {
+	return codec.rwc.Close()
+}
+
+func (codec *clientCodec) IsRequest(rawMessage rpc.RawMessage) bool {
+	return isRequestRawMessage(rawMessage)
+}
+
+func (codec *clientCodec) UnmarshalRequest(rawMessage rpc.RawMessage) (*rpc.RequestMessages, error) {
+	return parseRequestRawMessage(rawMessage)
+}
+
+func (codec *clientCodec) UnmarshalRequestParams(params rpc.MessageParams, ins rpc.Ins) ([]reflect.Value, error) {
+	return unmarshalRequestParams(params, ins)
+}
+
+func (codec *clientCodec) MarshalResponseResult(i interface{}) (rpc.MessageResult, error) {
+	return marshal(i)
+}
+
+func (codec *clientCodec) MarshalResponse(responses *rpc.ResponseMessages) (rpc.RawMessage, error) {
+	return marshalResponse(responses)
+}
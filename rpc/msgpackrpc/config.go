@@ -0,0 +1,38 @@
+package msgpackrpc
+
+import (
+	"io"
+
+	"github.com/smallsung/gopkg/rpc"
+)
+
+// ContentType HTTP 请求和响应的媒体类型, 用于 rpc.Server.RegisterCodec
+const ContentType = "application/msgpack"
+
+// NewHTTPServerCodec HTTP 请求体中的消息没有长度前缀:
+//
+//	server.RegisterCodec(msgpackrpc.ContentType, msgpackrpc.NewHTTPServerCodec)
+func NewHTTPServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	return Config{Framing: RawFraming}.NewServerCodec(conn)
+}
+
+// Config 编解码器的配置. 零值与 NewServerCodec, NewClientCodec 相同
+type Config struct {
+	// Framing 流式连接上消息的边界,默认 LengthPrefixFraming. HTTP 请求应该使用 RawFraming
+	Framing Framing
+}
+
+func (config Config) framing() Framing {
+	if config.Framing == nil {
+		return LengthPrefixFraming
+	}
+	return config.Framing
+}
+
+func (config Config) NewServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	return &serverCodec{rwc: conn, framer: config.framing()(conn)}
+}
+
+func (config Config) NewClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
+	return &clientCodec{rwc: conn, framer: config.framing()(conn)}
+}
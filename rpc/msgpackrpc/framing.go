@@ -0,0 +1,111 @@
+package msgpackrpc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/smallsung/gopkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// maxMessageLength 单条消息的最大长度
+const maxMessageLength = 1024 * 1024 * 5
+
+// Framer 在流式连接上读写完整的消息
+type Framer interface {
+	ReadFrame() ([]byte, error)
+	WriteFrame([]byte) error
+}
+
+// Framing 创建连接的 Framer
+type Framing func(rw io.ReadWriter) Framer
+
+var (
+	// LengthPrefixFraming 每条消息之前是4字节大端序的消息长度. 可以跳过错误的消息
+	LengthPrefixFraming Framing = newLengthPrefixFramer
+	// RawFraming 由 msgpack 的编码确定消息的边界,消息之间没有分隔符.
+	// 用于 HTTP 请求体, 无法跳过错误的消息
+	RawFraming Framing = newRawFramer
+)
+
+// parseError 错误的消息已经被跳过,可以继续读取下一条消息
+type parseError struct {
+	errors.Err
+}
+
+func newParseError(format string, args ...interface{}) *parseError {
+	err := &parseError{Err: errors.NewErr(format, args...)}
+	err.SetLocation(1)
+	return err
+}
+
+func (err *parseError) Recoverable() bool { return true }
+
+type lengthPrefixFramer struct {
+	writer io.Writer
+	reader *bufio.Reader
+}
+
+func newLengthPrefixFramer(rw io.ReadWriter) Framer {
+	return &lengthPrefixFramer{writer: rw, reader: bufio.NewReader(rw)}
+}
+
+func (f *lengthPrefixFramer) ReadFrame() ([]byte, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(f.reader, prefix[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(prefix[:])
+	if length > maxMessageLength {
+		if _, err := io.CopyN(ioutil.Discard, f.reader, int64(length)); err != nil {
+			return nil, err
+		}
+		return nil, newParseError("message too large: %d bytes", length)
+	}
+
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(f.reader, frame); err != nil {
+		return nil, err
+	}
+	if !isValidMessage(frame) {
+		return nil, newParseError("invalid message %x", frame)
+	}
+	return frame, nil
+}
+
+// isValidMessage frame 是一个完整的 msgpack 值
+func isValidMessage(frame []byte) bool {
+	decoder := newDecoder(frame)
+	if err := decoder.Skip(); err != nil {
+		return false
+	}
+	_, err := decoder.PeekCode()
+	return err == io.EOF
+}
+
+func (f *lengthPrefixFramer) WriteFrame(frame []byte) error {
+	buff := make([]byte, 4, 4+len(frame))
+	binary.BigEndian.PutUint32(buff, uint32(len(frame)))
+	_, err := f.writer.Write(append(buff, frame...))
+	return err
+}
+
+type rawFramer struct {
+	writer  io.Writer
+	decoder *msgpack.Decoder
+}
+
+func newRawFramer(rw io.ReadWriter) Framer {
+	return &rawFramer{writer: rw, decoder: msgpack.NewDecoder(rw)}
+}
+
+func (f *rawFramer) ReadFrame() ([]byte, error) {
+	return f.decoder.DecodeRaw()
+}
+
+func (f *rawFramer) WriteFrame(frame []byte) error {
+	_, err := f.writer.Write(frame)
+	return err
+}
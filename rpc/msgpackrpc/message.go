@@ -0,0 +1,382 @@
+package msgpackrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+
+	"github.com/smallsung/gopkg/errors"
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+// 消息与 JSON-RPC 2.0 的结构相同,但没有 jsonrpc 版本字段
+type MessageError struct {
+	Code    int64       `msgpack:"code"`
+	Message string      `msgpack:"message"`
+	Data    interface{} `msgpack:"data,omitempty"`
+	ErrorID string      `msgpack:"errorId,omitempty"`
+}
+
+// DecodeMsgpack 保留未解码的 data, 由 rpc.Client 根据错误码还原
+func (me *MessageError) DecodeMsgpack(decoder *msgpack.Decoder) error {
+	var v struct {
+		Code    int64              `msgpack:"code"`
+		Message string             `msgpack:"message"`
+		Data    msgpack.RawMessage `msgpack:"data"`
+		ErrorID string             `msgpack:"errorId"`
+	}
+	if err := decoder.Decode(&v); err != nil {
+		return err
+	}
+	me.Code, me.Message, me.Data, me.ErrorID = v.Code, v.Message, nil, v.ErrorID
+	if !isNil(v.Data) {
+		me.Data = v.Data
+	}
+	return nil
+}
+
+type RequestMessage struct {
+	ID          msgpack.RawMessage `msgpack:"id,omitempty"`
+	Method      string             `msgpack:"method,omitempty"`
+	Params      msgpack.RawMessage `msgpack:"params,omitempty"`
+	TraceParent string             `msgpack:"traceparent,omitempty"`
+}
+
+type ResponseMessage struct {
+	ID     msgpack.RawMessage `msgpack:"id"`
+	Result msgpack.RawMessage `msgpack:"result,omitempty"`
+	Error  *MessageError      `msgpack:"error,omitempty"`
+}
+
+var null = msgpack.RawMessage{msgpcode.Nil}
+
+func isNil(raw msgpack.RawMessage) bool {
+	return len(raw) == 0 || (len(raw) == 1 && raw[0] == msgpcode.Nil)
+}
+
+// marshal 整数使用最紧凑的编码,没有 msgpack 标签的字段使用 json 标签
+func marshal(v interface{}) ([]byte, error) {
+	var buff bytes.Buffer
+	encoder := msgpack.NewEncoder(&buff)
+	encoder.UseCompactInts(true)
+	encoder.SetCustomStructTag("json")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+func newDecoder(data []byte) *msgpack.Decoder {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	return decoder
+}
+
+func unmarshal(data []byte, v interface{}) error {
+	return newDecoder(data).Decode(v)
+}
+
+// toMessageID 将请求ID转换为 rpc.MessageID 的 JSON 文本
+func toMessageID(raw msgpack.RawMessage) (rpc.MessageID, error) {
+	if isNil(raw) {
+		return nil, nil
+	}
+	var v interface{}
+	if err := unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	switch id := v.(type) {
+	case int8, int16, int32, int64:
+		return strconv.AppendInt(nil, reflect.ValueOf(id).Int(), 10), nil
+	case uint8, uint16, uint32, uint64:
+		return strconv.AppendUint(nil, reflect.ValueOf(id).Uint(), 10), nil
+	default:
+		return json.Marshal(id)
+	}
+}
+
+// fromMessageID toMessageID 的逆过程
+func fromMessageID(id rpc.MessageID) (msgpack.RawMessage, error) {
+	if id == nil {
+		return null, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(id))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	if n, ok := v.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			v = i
+		} else if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+			v = u
+		} else if v, err = n.Float64(); err != nil {
+			return nil, err
+		}
+	}
+	return marshal(v)
+}
+
+func toRPCRequestMessage(request *RequestMessage) *rpc.RequestMessage {
+	id, err := toMessageID(request.ID)
+	if err != nil {
+		return new(rpc.RequestMessage)
+	}
+	return &rpc.RequestMessage{
+		ID:          id,
+		Method:      request.Method,
+		Params:      rpc.MessageParams(request.Params),
+		TraceParent: request.TraceParent,
+	}
+}
+
+func toRequestMessage(request *rpc.RequestMessage) (*RequestMessage, error) {
+	to := &RequestMessage{
+		Method:      request.Method,
+		Params:      msgpack.RawMessage(request.Params),
+		TraceParent: request.TraceParent,
+	}
+	if request.ID != nil {
+		var err error
+		if to.ID, err = fromMessageID(request.ID); err != nil {
+			return nil, errors.Annotate(err, "fromMessageID")
+		}
+	}
+	return to, nil
+}
+
+func toResponseMessage(response *rpc.ResponseMessage) (*ResponseMessage, error) {
+	id, err := fromMessageID(response.ID)
+	if err != nil {
+		return nil, errors.Annotate(err, "fromMessageID")
+	}
+	to := &ResponseMessage{ID: id, Result: msgpack.RawMessage(response.Result)}
+	if response.Error != nil {
+		to.Error = &MessageError{
+			Code:    response.Error.Code,
+			Message: response.Error.Message,
+			Data:    response.Error.Data,
+			ErrorID: response.Error.ErrorID,
+		}
+	}
+	return to, nil
+}
+
+func toRPCResponseMessage(response *ResponseMessage) *rpc.ResponseMessage {
+	id, err := toMessageID(response.ID)
+	if err != nil {
+		return new(rpc.ResponseMessage)
+	}
+	to := &rpc.ResponseMessage{ID: id, Result: rpc.MessageResult(response.Result)}
+	// 解码 result: nil 得到空的 RawMessage, 恢复为 nil 以免被当作缺少 result
+	if response.Error == nil && len(to.Result) == 0 {
+		to.Result = rpc.MessageResult(null)
+	}
+	if response.Error != nil {
+		to.Error = &rpc.MessageError{
+			Code:    response.Error.Code,
+			Message: response.Error.Message,
+			Data:    response.Error.Data,
+			ErrorID: response.Error.ErrorID,
+		}
+	}
+	return to
+}
+
+// isArrayRawMessage 第一个字节是数组类型时 rawMessage 是批处理消息
+func isArrayRawMessage(rawMessage []byte) bool {
+	if len(rawMessage) == 0 {
+		return false
+	}
+	c := rawMessage[0]
+	return msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32
+}
+
+// decodeBatch 逐个解码批处理消息中的元素, 无法解码的元素为 nil
+func decodeBatch(rawMessage []byte, decode func(raw msgpack.RawMessage) error) error {
+	decoder := newDecoder(rawMessage)
+	n, err := decoder.DecodeArrayLen()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		raw, err := decoder.DecodeRaw()
+		if err != nil {
+			return err
+		}
+		if err = decode(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseRequestRawMessage(rawMessage []byte) (*rpc.RequestMessages, error) {
+	requests := rpc.NewRequestMessages()
+	if !isArrayRawMessage(rawMessage) {
+		var v RequestMessage
+		if err := unmarshal(rawMessage, &v); err != nil {
+			return nil, err
+		}
+		requests.Append(toRPCRequestMessage(&v))
+		return requests, nil
+	}
+
+	err := decodeBatch(rawMessage, func(raw msgpack.RawMessage) error {
+		var v RequestMessage
+		if err := unmarshal(raw, &v); err != nil {
+			requests.Append(new(rpc.RequestMessage))
+		} else {
+			requests.Append(toRPCRequestMessage(&v))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	requests.Batch = true
+	return requests, nil
+}
+
+func parseResponseRawMessage(rawMessage []byte) (*rpc.ResponseMessages, error) {
+	responses := rpc.NewResponseMessages()
+	if !isArrayRawMessage(rawMessage) {
+		var v ResponseMessage
+		if err := unmarshal(rawMessage, &v); err != nil {
+			return nil, err
+		}
+		responses.Append(toRPCResponseMessage(&v))
+		return responses, nil
+	}
+
+	err := decodeBatch(rawMessage, func(raw msgpack.RawMessage) error {
+		var v ResponseMessage
+		if err := unmarshal(raw, &v); err != nil {
+			responses.Append(new(rpc.ResponseMessage))
+		} else {
+			responses.Append(toRPCResponseMessage(&v))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	responses.Batch = true
+	return responses, nil
+}
+
+func marshalRequest(requests *rpc.RequestMessages) ([]byte, error) {
+	s := make([]*RequestMessage, 0, len(requests.Elems))
+	for _, m := range requests.Elems {
+		request, err := toRequestMessage(m)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, request)
+	}
+	if requests.Batch {
+		return marshal(s)
+	}
+	return marshal(s[0])
+}
+
+func marshalResponse(responses *rpc.ResponseMessages) ([]byte, error) {
+	s := make([]*ResponseMessage, 0, len(responses.Elems))
+	for _, m := range responses.Elems {
+		response, err := toResponseMessage(m)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, response)
+	}
+	if responses.Batch {
+		return marshal(s)
+	}
+	return marshal(s[0])
+}
+
+func unmarshalRequestParams(params rpc.MessageParams, ins rpc.Ins) ([]reflect.Value, error) {
+	if !isNil(params) && !isArrayRawMessage(params) {
+		return nil, rpc.NewArgumentError(-1, nil, "params must be an array")
+	}
+	return parsePositionalArguments(params, ins)
+}
+
+// parsePositionalArguments 省略 params 时与空数组相同. 可变参数的每个元素作为单独的参数返回
+func parsePositionalArguments(params rpc.MessageParams, ins rpc.Ins) ([]reflect.Value, error) {
+	var args []reflect.Value
+	if !isNil(params) {
+		decoder := newDecoder(params)
+		n, err := decoder.DecodeArrayLen()
+		if err != nil {
+			return nil, rpc.NewArgumentError(-1, nil, "%v", err)
+		}
+		for i := 0; i < n; i++ {
+			typ, ok := ins.ArgumentType(i)
+			if !ok {
+				return nil, rpc.NewArgumentError(i, nil, "too many arguments, want at most %d", len(ins.Position))
+			}
+			val := reflect.New(typ)
+			if err = decoder.Decode(val.Interface()); err != nil {
+				return nil, rpc.NewArgumentError(i, typ, "%v", err)
+			}
+			args = append(args, val.Elem())
+		}
+	}
+	for i := len(args); i < ins.NumFixed(); i++ {
+		switch ins.Position[i].Kind() {
+		case reflect.Ptr, reflect.Interface:
+		default:
+			return nil, rpc.NewArgumentError(i, ins.Position[i], "missing value for required argument")
+		}
+		args = append(args, reflect.Zero(ins.Position[i]))
+	}
+	return args, nil
+}
+
+// messageKind 只扫描字段名,不解码字段的值. 批处理消息以第一个元素为准.
+// 先遇到 method 的消息是请求或者通知,先遇到 result 或者 error 的消息是响应
+func messageKind(rawMessage []byte) (request, response bool) {
+	decoder := newDecoder(rawMessage)
+	if isArrayRawMessage(rawMessage) {
+		if n, err := decoder.DecodeArrayLen(); err != nil || n <= 0 {
+			return false, false
+		}
+	}
+	n, err := decoder.DecodeMapLen()
+	if err != nil {
+		return false, false
+	}
+	for i := 0; i < n; i++ {
+		key, err := decoder.DecodeString()
+		if err != nil {
+			return false, false
+		}
+		switch key {
+		case "method":
+			return true, false
+		case "result", "error":
+			return false, true
+		}
+		if err := decoder.Skip(); err != nil {
+			return false, false
+		}
+	}
+	return false, false
+}
+
+// isRequestRawMessage 包含 method 的消息是请求或者通知
+func isRequestRawMessage(rawMessage []byte) bool {
+	request, _ := messageKind(rawMessage)
+	return request
+}
+
+// isResponseRawMessage 没有 method 并且包含 result 或者 error 的消息是响应
+func isResponseRawMessage(rawMessage []byte) bool {
+	_, response := messageKind(rawMessage)
+	return response
+}
@@ -0,0 +1,73 @@
+package msgpackrpc_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/smallsung/gopkg/errors"
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/msgpackrpc"
+)
+
+type Blob struct {
+	Name string `json:"name"`
+	Data []byte `json:"data"`
+}
+
+type TooLarge struct {
+	Limit int `json:"limit"`
+}
+
+var errTooLarge = rpc.DefineError(-32050, "BlobTooLarge", "blob too large, limit {{.Limit}}", TooLarge{})
+
+type blobService struct{}
+
+func (blobService) Store(b Blob) (int, error) {
+	if len(b.Data) > 4 {
+		return 0, errTooLarge.New(TooLarge{Limit: 4})
+	}
+	return len(b.Data), nil
+}
+
+func (blobService) Load(name string) Blob {
+	return Blob{Name: name, Data: []byte{0, 1, 2}}
+}
+
+func TestMsgpackCodec(t *testing.T) {
+	server := rpc.NewServer(msgpackrpc.NewServerCodec)
+	if err := server.Register("blob", blobService{}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(context.Background(), server, msgpackrpc.NewClientCodec)
+	defer client.Close()
+	ctx := context.Background()
+
+	var loaded Blob
+	if err := client.Call(ctx, "blob.load", &loaded, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != "a" || !bytes.Equal(loaded.Data, []byte{0, 1, 2}) {
+		t.Fatalf("unexpected blob %#v", loaded)
+	}
+
+	var size int
+	err := client.Call(ctx, "blob.store", &size, Blob{Data: make([]byte, 8)})
+	var codeErr *rpc.CodeError
+	if !errors.Is(err, errTooLarge) || !errors.As(err, &codeErr) || codeErr.Data.(TooLarge).Limit != 4 {
+		t.Fatalf("want %v, got %#v", errTooLarge, err)
+	}
+
+	var sizes [2]int
+	elems := []rpc.BatchElem{
+		{Method: "blob.store", Params: []interface{}{Blob{Data: []byte{1}}}, Result: &sizes[0]},
+		{Method: "blob.store", Params: []interface{}{Blob{Data: []byte{1, 2}}}, Result: &sizes[1]},
+		{Method: "blob.missing", Params: []interface{}{1}},
+	}
+	if err := client.Bath(ctx, elems...); err == nil {
+		t.Fatal("want error from blob.missing")
+	}
+	if sizes != [2]int{1, 2} || elems[0].Error != nil || elems[1].Error != nil || elems[2].Error == nil {
+		t.Fatalf("unexpected batch results %v %v", sizes, elems)
+	}
+}
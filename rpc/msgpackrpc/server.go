@@ -0,0 +1,74 @@
+package msgpackrpc
+
+import (
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/smallsung/gopkg/rpc"
+)
+
+type serverCodec struct {
+	rwc    io.ReadWriteCloser
+	framer Framer
+	// mu 双向调用时请求和响应可能同时写入
+	mu sync.Mutex
+}
+
+func NewServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	return Config{}.NewServerCodec(conn)
+}
+
+func (codec *serverCodec) ReadRequest() (rpc.RawMessage, error) {
+	return codec.framer.ReadFrame()
+}
+
+func (codec *serverCodec) UnmarshalRequest(rawMessage rpc.RawMessage) (*rpc.RequestMessages, error) {
+	return parseRequestRawMessage(rawMessage)
+}
+
+func (codec *serverCodec) UnmarshalRequestParams(params rpc.MessageParams, ins rpc.Ins) ([]reflect.Value, error) {
+	return unmarshalRequestParams(params, ins)
+}
+
+func (codec *serverCodec) MarshalResponseResult(i interface{}) (rpc.MessageResult, error) {
+	return marshal(i)
+}
+
+func (codec *serverCodec) MarshalResponse(responses *rpc.ResponseMessages) (rpc.RawMessage, error) {
+	return marshalResponse(responses)
+}
+
+func (codec *serverCodec) WriteResponse(rawMessage rpc.RawMessage) error {
+	codec.mu.Lock()
+	defer codec.mu.Unlock()
+	return codec.framer.WriteFrame(rawMessage)
+}
+
+func (codec *serverCodec) ContentType() string {
+	return ContentType
+}
+
+func (codec *serverCodec) Close() error {
+	return codec.rwc.Close()
+}
+
+func (codec *serverCodec) IsResponse(rawMessage rpc.RawMessage) bool {
+	return isResponseRawMessage(rawMessage)
+}
+
+func (codec *serverCodec) MarshalRequestParams(i ...interface{}) (rpc.MessageParams, error) {
+	return marshal(i)
+}
+
+func (codec *serverCodec) MarshalRequest(requests *rpc.RequestMessages) (rpc.RawMessage, error) {
+	return marshalRequest(requests)
+}
+
+func (codec *serverCodec) UnmarshalResponse(rawMessage rpc.RawMessage) (*rpc.ResponseMessages, error) {
+	return parseResponseRawMessage(rawMessage)
+}
+
+func (codec *serverCodec) UnmarshalResponseResult(rawMessage rpc.MessageResult, i interface{}) error {
+	return unmarshal(rawMessage, i)
+}
@@ -0,0 +1,44 @@
+package rpc
+
+import (
+	"strings"
+
+	"github.com/smallsung/gopkg/errors"
+	strings2 "github.com/smallsung/gopkg/strings"
+)
+
+// NamingPolicy 把 Go 的方法名转换为 rpc 的方法名. 通过 RegisterFunc, MethodName, MethodAlias 指定的名称不做转换
+type NamingPolicy func(name string) string
+
+var (
+	// NamingLowerFirst 默认的命名, 首字母小写 "GetHTTPStatus" -> "getHTTPStatus"
+	NamingLowerFirst NamingPolicy = strings2.LowerFirst
+	// NamingLowerCamel "GetHTTPStatus" -> "getHttpStatus"
+	NamingLowerCamel NamingPolicy = strings2.LowerCamelCase
+	// NamingSnake "GetHTTPStatus" -> "get_http_status"
+	NamingSnake NamingPolicy = strings2.SnakeCase
+	// NamingExact 保持 Go 的方法名 "GetHTTPStatus"
+	NamingExact NamingPolicy = func(name string) string { return name }
+)
+
+func (s *Server) naming() NamingPolicy {
+	if s.Naming == nil {
+		return NamingLowerFirst
+	}
+	return s.Naming
+}
+
+// checkNamespace 命名空间中包含分隔符时无法正确拆分方法名
+func (s *Server) checkNamespace(namespace string) error {
+	if strings.Contains(namespace, s.separator()) {
+		return errors.Format("namespace %s contains separator %q", namespace, s.separator())
+	}
+	return nil
+}
+
+func (s *Server) separator() string {
+	if s.Separator == "" {
+		return MethodSeparator
+	}
+	return s.Separator
+}
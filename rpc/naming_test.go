@@ -0,0 +1,41 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+type chainService struct{}
+
+func (chainService) GetBlockNumber() uint64 { return 42 }
+
+func TestNamingPolicy(t *testing.T) {
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	server.Naming, server.Separator = rpc.NamingSnake, "_"
+	if err := server.Register("eth", chainService{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Register("my_eth", chainService{}); err == nil {
+		t.Fatal("register namespace containing separator succeeded")
+	}
+	client := rpc.DialInProc(context.Background(), server, jsonrpc.NewClientCodec)
+	defer client.Close()
+
+	ctx := context.Background()
+	var number uint64
+	if err := client.Call(ctx, "eth_get_block_number", &number); err != nil || number != 42 {
+		t.Fatalf("eth_get_block_number: %d, %v", number, err)
+	}
+	if err := client.Call(ctx, "eth.get_block_number", &number); err == nil {
+		t.Fatal("call with default separator succeeded")
+	}
+	for _, method := range []string{"rpc_modules", "rpc.modules"} {
+		var modules []string
+		if err := client.Call(ctx, method, &modules); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+	}
+}
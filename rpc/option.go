@@ -0,0 +1,114 @@
+package rpc
+
+import (
+	"time"
+
+	"github.com/smallsung/gopkg/errors"
+)
+
+// MethodOption 注册方法时的选项
+type MethodOption func(*methodOptions)
+
+type methodOptions struct {
+	name       string
+	aliases    []string
+	deprecated string
+	timeout    time.Duration
+	hidden     bool
+	// resultNames 见 MethodResultNames
+	resultNames []string
+	// methods ForMethod 指定的单个方法的选项
+	methods map[string][]MethodOption
+}
+
+// MethodName 使用 name 代替默认的方法名,只能作用于单个方法
+func MethodName(name string) MethodOption {
+	return func(o *methodOptions) { o.name = name }
+}
+
+// MethodAlias 方法可以同时通过 aliases 调用
+func MethodAlias(aliases ...string) MethodOption {
+	return func(o *methodOptions) { o.aliases = append(o.aliases, aliases...) }
+}
+
+// MethodDeprecated 方法仍然可以调用,每次调用记录包含 message 的警告日志
+func MethodDeprecated(message string) MethodOption {
+	return func(o *methodOptions) { o.deprecated = message }
+}
+
+// MethodTimeout 方法的 context 在 timeout 之后取消
+func MethodTimeout(timeout time.Duration) MethodOption {
+	return func(o *methodOptions) { o.timeout = timeout }
+}
+
+// MethodHidden 方法可以调用,但是不出现在 rpc.modules 与 rpc.module 中
+func MethodHidden() MethodOption {
+	return func(o *methodOptions) { o.hidden = true }
+}
+
+// MethodResultNames 多个结果编码为以 names 为键的对象,默认编码为数组. names 的个数必须与 error 之外的结果个数相同
+func MethodResultNames(names ...string) MethodOption {
+	return func(o *methodOptions) { o.resultNames = names }
+}
+
+// ForMethod 只作用于默认名称为 method 的方法
+func ForMethod(method string, opts ...MethodOption) MethodOption {
+	return func(o *methodOptions) {
+		if o.methods == nil {
+			o.methods = make(map[string][]MethodOption)
+		}
+		o.methods[method] = append(o.methods[method], opts...)
+	}
+}
+
+func applyMethodOptions(cbs map[string]*callback, opts []MethodOption) (map[string]*callback, error) {
+	var common methodOptions
+	for _, opt := range opts {
+		opt(&common)
+	}
+	if common.name != "" && len(cbs) > 1 {
+		return nil, errors.Format("MethodName %s can't apply to %d methods", common.name, len(cbs))
+	}
+	for method := range common.methods {
+		if _, exist := cbs[method]; !exist {
+			return nil, errors.Format("ForMethod %s doesn't exist", method)
+		}
+	}
+
+	named := make(map[string]*callback, len(cbs))
+	add := func(name string, cb *callback) error {
+		if _, exist := named[name]; exist {
+			return errors.Annotate(ErrCallbackNameExist, name)
+		}
+		named[name] = cb
+		return nil
+	}
+	for method, cb := range cbs {
+		options := common
+		options.aliases = append([]string(nil), common.aliases...)
+		for _, opt := range common.methods[method] {
+			opt(&options)
+		}
+		cb.deprecated, cb.timeout, cb.hidden = options.deprecated, options.timeout, options.hidden
+		if options.resultNames != nil {
+			if len(options.resultNames) != len(cb.outs.Position) {
+				return nil, errors.Format("MethodResultNames %v doesn't match %d results of %s", options.resultNames, len(cb.outs.Position), method)
+			}
+			cb.resultNames = options.resultNames
+		}
+
+		name := method
+		if options.name != "" {
+			name = options.name
+		}
+		if err := add(name, cb); err != nil {
+			return nil, err
+		}
+		for _, alias := range options.aliases {
+			if err := add(alias, cb); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return named, nil
+}
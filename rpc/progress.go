@@ -0,0 +1,115 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/smallsung/gopkg/errors"
+)
+
+// progressMethod 服务端向调用方报告进度的通知
+const progressMethod = builtinServiceName + MethodSeparator + "progress"
+
+// Progress 回调向调用方报告执行进度. 进度通知一定先于调用的结果到达调用方
+type Progress struct {
+	ctx    context.Context
+	client *Client
+	id     interface{}
+}
+
+// ProgressFromContext 返回当前调用的 Progress.
+// HTTP 请求,通知或者编解码器不支持双向调用时返回 nil, 此时 Report 不做任何事
+func ProgressFromContext(ctx context.Context) *Progress {
+	conn, request := ConnectionFromContext(ctx), RequestFromContext(ctx)
+	if conn == nil || conn.client == nil || request == nil || request.IsNotification() {
+		return nil
+	}
+	return &Progress{ctx: ctx, client: conn.client, id: decodeMessageID(request.ID)}
+}
+
+// Report 发送进度通知. value 由调用方通过 PartialResult.Decode 解码
+func (p *Progress) Report(value interface{}) error {
+	if p == nil {
+		return nil
+	}
+	return errors.Trace(p.client.Notice(p.ctx, progressMethod, p.id, value))
+}
+
+// ProgressHandler 处理调用的进度通知. 按照到达的顺序调用,不应该阻塞
+type ProgressHandler func(p PartialResult)
+
+// PartialResult 进度通知携带的值
+type PartialResult struct {
+	value interface{}
+	codec DuplexClientCodec
+}
+
+// Decode 将进度值解码到 v
+func (p PartialResult) Decode(v interface{}) error {
+	raw, err := p.codec.MarshalResponseResult(p.value)
+	if err != nil {
+		return errors.Annotate(err, "codec.MarshalResponseResult")
+	}
+	return errors.Annotate(p.codec.UnmarshalResponseResult(raw, v), "codec.UnmarshalResponseResult")
+}
+
+type progressOption ProgressHandler
+
+func (o progressOption) applyCall(call *Call) { call.progress = ProgressHandler(o) }
+
+// WithProgress CallAsync, Call 的选项, 调用收到进度通知时调用 handler. 只支持流式连接
+func WithProgress(handler ProgressHandler) CallOption {
+	return progressOption(handler)
+}
+
+// partialHandlers 按请求ID保存进度,流等部分结果的处理函数
+type partialHandlers struct {
+	mu       sync.Mutex
+	handlers map[string]func(PartialResult)
+}
+
+// add 在 call 结束时移除 handler
+func (h *partialHandlers) add(call *Call, handler func(PartialResult)) {
+	h.mu.Lock()
+	if h.handlers == nil {
+		h.handlers = make(map[string]func(PartialResult))
+	}
+	for _, request := range call.requests.Elems {
+		if !request.IsNotification() {
+			h.handlers[string(request.ID)] = handler
+		}
+	}
+	h.mu.Unlock()
+
+	finish := call.finish
+	call.finish = func() {
+		h.mu.Lock()
+		for _, request := range call.requests.Elems {
+			delete(h.handlers, string(request.ID))
+		}
+		h.mu.Unlock()
+		if finish != nil {
+			finish()
+		}
+	}
+}
+
+// deliver 调用已经结束或者没有设置处理函数时忽略
+func (h *partialHandlers) deliver(client *Client, id interface{}, value interface{}) error {
+	raw, err := encodeMessageID(id)
+	if err != nil {
+		return errors.Annotate(err, "encodeMessageID")
+	}
+	h.mu.Lock()
+	handler := h.handlers[string(raw)]
+	h.mu.Unlock()
+	if handler != nil {
+		handler(PartialResult{value: value, codec: client.codec.(DuplexClientCodec)})
+	}
+	return nil
+}
+
+// Progress 调用已经结束或者没有设置 ProgressHandler 时忽略
+func (s clientBuiltinService) Progress(id interface{}, value interface{}) error {
+	return s.client.progress.deliver(s.client, id, value)
+}
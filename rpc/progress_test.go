@@ -0,0 +1,53 @@
+package rpc_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+type importStep struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+type importService struct{}
+
+func (importService) Run(ctx context.Context, total int) (int, error) {
+	progress := rpc.ProgressFromContext(ctx)
+	for i := 1; i <= total; i++ {
+		if err := progress.Report(importStep{Done: i, Total: total}); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+func TestProgress(t *testing.T) {
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("import", importService{}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(context.Background(), server, jsonrpc.NewClientCodec)
+	defer client.Close()
+
+	var steps []importStep
+	progress := rpc.WithProgress(func(p rpc.PartialResult) {
+		var step importStep
+		if err := p.Decode(&step); err != nil {
+			t.Error(err)
+		}
+		steps = append(steps, step)
+	})
+	var result int
+	if err := client.Call(context.Background(), "import.run", &result, 3, progress); err != nil {
+		t.Fatal(err)
+	}
+	want := []importStep{{1, 3}, {2, 3}, {3, 3}}
+	if result != 3 || !reflect.DeepEqual(steps, want) {
+		t.Fatalf("want %v and result 3, got %v and result %d", want, steps, result)
+	}
+}
@@ -0,0 +1,76 @@
+package rpc_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+type arithService struct{}
+
+func (arithService) Add(a, b int) int { return a + b }
+
+func (arithService) Sub(a, b int) int { return a - b }
+
+func TestRegisterFunc(t *testing.T) {
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	offset := 10
+	if err := server.RegisterFunc("calc", "offset", func(n int) int { return n + offset }, rpc.MethodAlias("shift")); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterFunc("calc", "sleep", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, rpc.MethodTimeout(10*time.Millisecond), rpc.MethodHidden()); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Register("math", arithService{},
+		rpc.ForMethod("add", rpc.MethodName("plus")),
+		rpc.ForMethod("sub", rpc.MethodDeprecated("use plus"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterFunc("calc", "offset", func() {}); err == nil {
+		t.Fatal("register duplicate method succeeded")
+	}
+	if err := server.Register("math2", arithService{}, rpc.MethodName("x")); err == nil {
+		t.Fatal("MethodName for several methods succeeded")
+	}
+
+	client := rpc.DialInProc(context.Background(), server, jsonrpc.NewClientCodec)
+	defer client.Close()
+	ctx := context.Background()
+
+	for method, want := range map[string]int{"calc.offset": 11, "calc.shift": 11, "math.plus": 3, "math.sub": -1} {
+		var got int
+		var args []interface{}
+		if method == "math.plus" || method == "math.sub" {
+			args = []interface{}{1, 2}
+		} else {
+			args = []interface{}{1}
+		}
+		if err := client.Call(ctx, method, &got, args...); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if got != want {
+			t.Fatalf("%s: want %d, got %d", method, want, got)
+		}
+	}
+	if err := client.Call(ctx, "math.add", nil, 1, 2); err == nil {
+		t.Fatal("call renamed method succeeded")
+	}
+	if err := client.Call(ctx, "calc.sleep", nil); err == nil {
+		t.Fatal("timeout method succeeded")
+	}
+
+	var methods []string
+	if err := client.Call(ctx, "rpc.module", &methods, "calc"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"offset", "shift"}; !reflect.DeepEqual(methods, want) {
+		t.Fatalf("methods: want %v, got %v", want, methods)
+	}
+}
@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 
@@ -13,24 +14,62 @@ type service struct {
 	callbacks map[string]*callback
 }
 
+// visible 所有方法都隐藏的命名空间不出现在 rpc.modules 中
+func (s service) visible() bool {
+	for _, cb := range s.callbacks {
+		if !cb.hidden {
+			return true
+		}
+	}
+	return false
+}
+
 type registry struct {
 	services map[string]service
 	mu       sync.Mutex
+	// revision 每次修改服务时递增
+	revision uint64
 }
 
-func (r *registry) register(namespaces string, receiver interface{}) (err error) {
+func receiverCallbacks(namespaces string, receiver interface{}, naming NamingPolicy, opts []MethodOption) (map[string]*callback, error) {
 	rv := reflect.ValueOf(receiver)
 	if namespaces == "" {
-		return errors.Format("%s namespace empty", rv.Type().String())
+		return nil, errors.Format("%s namespace empty", rv.Type().String())
 	}
-	var cbs map[string]*callback
-	if cbs, err = suitableCallbacks(rv); err != nil {
-		return errors.Trace(err)
+	cbs, err := suitableCallbacks(rv, naming)
+	if err != nil {
+		return nil, errors.Trace(err)
 	}
 	if len(cbs) == 0 {
-		return errors.Format("%s doesn't have any suitable methods", rv.Type().String())
+		return nil, errors.Format("%s doesn't have any suitable methods", rv.Type().String())
+	}
+	if err = compileValidators(cbs); err != nil {
+		return nil, err
 	}
+	return applyMethodOptions(cbs, opts)
+}
 
+func funcCallbacks(namespace, method string, fn interface{}, opts []MethodOption) (map[string]*callback, error) {
+	rv := reflect.ValueOf(fn)
+	if namespace == "" || method == "" {
+		return nil, errors.Format("%s.%s namespace or method empty", namespace, method)
+	}
+	if rv.Kind() != reflect.Func {
+		return nil, errors.Format("%T is not a function", fn)
+	}
+	cb := makeCallback(rv, reflect.Value{})
+	if cb == nil {
+		return nil, errors.Format("%s.%s %s is not a suitable callback", namespace, method, rv.Type().String())
+	}
+	cbs := map[string]*callback{method: cb}
+	if err := compileValidators(cbs); err != nil {
+		return nil, err
+	}
+	return applyMethodOptions(cbs, opts)
+}
+
+// register 返回修改之后的 revision
+func (r *registry) register(namespaces string, cbs map[string]*callback) (revision uint64, err error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -44,25 +83,79 @@ func (r *registry) register(namespaces string, receiver interface{}) (err error)
 	} else {
 		for name, _ := range cbs {
 			if _, exist := r.services[namespaces].callbacks[name]; exist {
-				return errors.Annotatef(ErrCallbackNameExist, "%s.%s", namespaces, name)
+				return 0, errors.Annotatef(ErrCallbackNameExist, "%s.%s", namespaces, name)
 			}
 		}
 	}
 	for name, cb := range cbs {
 		r.services[namespaces].callbacks[name] = cb
 	}
-	return nil
+	r.revision++
+	return r.revision, nil
 }
 
-const MethodSeparator = "."
+// unregister 正在执行的调用不受影响
+func (r *registry) unregister(namespace string) (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exist := r.services[namespace]; !exist {
+		return 0, errors.Format("namespace %s not registered", namespace)
+	}
+	delete(r.services, namespace)
+	r.revision++
+	return r.revision, nil
+}
 
-func (r *registry) callback(method string) *callback {
-	elem := strings.SplitN(method, MethodSeparator, 2)
-	if len(elem) != 2 {
-		return nil
+// replace 替换命名空间中的所有方法,命名空间不存在时与 register 相同
+func (r *registry) replace(namespace string, cbs map[string]*callback) (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.services == nil {
+		r.services = make(map[string]service)
+	}
+	r.services[namespace] = service{name: "", callbacks: cbs}
+	r.revision++
+	return r.revision, nil
+}
+
+func (r *registry) modules() (modules []string, revision uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for namespace, svc := range r.services {
+		if svc.visible() {
+			modules = append(modules, namespace)
+		}
+	}
+	sort.Strings(modules)
+	return modules, r.revision
+}
+
+func (r *registry) methods(namespace string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	methods := make([]string, 0)
+	for name, cb := range r.services[namespace].callbacks {
+		if !cb.hidden {
+			methods = append(methods, name)
+		}
 	}
+	sort.Strings(methods)
+	return methods
+}
+
+const MethodSeparator = "."
 
+// callback 按 separator 拆分方法名. 内置的 rpc 命名空间同时接受 MethodSeparator
+func (r *registry) callback(method, separator string) *callback {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	return r.services[elem[0]].callbacks[elem[1]]
+	if elem := strings.SplitN(method, separator, 2); len(elem) == 2 {
+		if cb := r.services[elem[0]].callbacks[elem[1]]; cb != nil {
+			return cb
+		}
+	}
+	if name := strings.TrimPrefix(method, builtinServiceName+MethodSeparator); name != method {
+		return r.services[builtinServiceName].callbacks[name]
+	}
+	return nil
 }
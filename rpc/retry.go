@@ -0,0 +1,133 @@
+package rpc
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/smallsung/gopkg/errors"
+	"go.uber.org/zap"
+)
+
+// RetryPolicy Client.Call 的重试策略. 只重试幂等的方法: 列在 Idempotent 中,或者通过 WithIdempotent 标记的调用.
+// 只在传输错误或者服务端返回 Codes 中的错误码时重试. ErrClientClosed 不重试,因为 Client 不会重新连接; CircuitOpenError 不重试
+type RetryPolicy struct {
+	// MaxAttempts 包括第一次调用,为 0 时使用 3
+	MaxAttempts int
+	// InitialBackoff 第一次重试之前的等待时间,为 0 时使用 100ms
+	InitialBackoff time.Duration
+	// MaxBackoff 为 0 时不限制
+	MaxBackoff time.Duration
+	// Multiplier 每次重试等待时间的倍数,为 0 时使用 2
+	Multiplier float64
+	// Jitter 等待时间随机减少的比例, 0 到 1 之间
+	Jitter float64
+	// Codes 服务端返回这些错误码时也重试
+	Codes []int64
+	// Idempotent 可以重试的方法
+	Idempotent []string
+}
+
+// WithIdempotent 标记通过 ctx 发起的调用是幂等的,可以重试
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentContextKey, true)
+}
+
+func isIdempotent(ctx context.Context) bool {
+	idempotent, _ := ctx.Value(idempotentContextKey).(bool)
+	return idempotent
+}
+
+func (p *RetryPolicy) idempotent(ctx context.Context, method string) bool {
+	if isIdempotent(ctx) {
+		return true
+	}
+	for _, m := range p.Idempotent {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	var coe *CircuitOpenError
+	if errors.Is(err, ErrClientClosed) || errors.As(err, &coe) {
+		return false
+	}
+	if IsTransportError(err) {
+		return true
+	}
+	if code, ok := errorCode(err); ok {
+		for _, c := range p.Codes {
+			if c == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// errorCode 服务端返回的错误码
+func errorCode(err error) (int64, bool) {
+	var me *MessageError
+	if errors.As(err, &me) {
+		return me.Code, true
+	}
+	var ec ErrorCode
+	if errors.As(err, &ec) {
+		return ec.RPCErrorCode(), true
+	}
+	return 0, false
+}
+
+// backoff 第 attempt 次重试之前的等待时间
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	backoff, multiplier := float64(p.InitialBackoff), p.Multiplier
+	if backoff == 0 {
+		backoff = float64(100 * time.Millisecond)
+	}
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	for i := 1; i < attempt; i++ {
+		backoff *= multiplier
+		if p.MaxBackoff > 0 && backoff >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff -= backoff * p.Jitter * rand.Float64()
+	}
+	return time.Duration(backoff)
+}
+
+// do 重试 fn. 等待时间超过 ctx 剩余的时间时不再重试,返回最后一次的错误
+func (p *RetryPolicy) do(ctx context.Context, logger *zap.Logger, method string, fn func() error) error {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 3
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= maxAttempts || !p.retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		backoff := p.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return err
+		}
+		logger.Debug("client.retry", zap.String("method", method), zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smallsung/gopkg/errors"
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+type busyError struct{}
+
+func (busyError) Error() string       { return "busy" }
+func (busyError) RPCErrorCode() int64 { return -32001 }
+
+type flakyService struct {
+	failures *int64
+}
+
+func (s flakyService) Get() (string, error) {
+	if atomic.AddInt64(s.failures, -1) >= 0 {
+		return "", busyError{}
+	}
+	return "ok", nil
+}
+
+func TestRetry(t *testing.T) {
+	var failures, unavailable int64
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("flaky", flakyService{&failures}); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&unavailable, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		server.ServeHTTP(w, r)
+	}))
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+	client := rpc.DialHTTP(context.Background(), URL, jsonrpc.NewClientCodec)
+	client.Retry = &rpc.RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond, Jitter: 0.5, Codes: []int64{-32001}, Idempotent: []string{"flaky.get"}}
+	ctx := context.Background()
+
+	var result string
+	atomic.StoreInt64(&unavailable, 1)
+	atomic.StoreInt64(&failures, 2)
+	if err := client.Call(ctx, "flaky.get", &result); err != nil || result != "ok" {
+		t.Fatalf("retry: %q, %v", result, err)
+	}
+
+	// 没有标记为幂等的方法不重试
+	atomic.StoreInt64(&unavailable, 1)
+	if err := client.Call(ctx, "flaky.other", &result); !rpc.IsTransportError(err) {
+		t.Fatalf("want transport error, got %v", err)
+	}
+	atomic.StoreInt64(&unavailable, 1)
+	atomic.StoreInt64(&failures, 0)
+	if err := client.Call(rpc.WithIdempotent(ctx), "flaky.get", &result); err != nil {
+		t.Fatalf("WithIdempotent: %v", err)
+	}
+
+	// 超过 MaxAttempts
+	atomic.StoreInt64(&failures, 4)
+	if err := client.Call(ctx, "flaky.get", &result); err == nil {
+		t.Fatal("want error after MaxAttempts")
+	}
+
+	// 等待时间超过 ctx 的剩余时间时不再重试
+	client.Retry.InitialBackoff = time.Hour
+	atomic.StoreInt64(&failures, 1)
+	deadlineCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := client.Call(deadlineCtx, "flaky.get", &result); err == nil || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("want immediate error, got %v after %s", err, time.Since(start))
+	}
+}
+
+func TestLocalErrorsNotRetried(t *testing.T) {
+	var failures, requests int64
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("flaky", flakyService{&failures}); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		server.ServeHTTP(w, r)
+	}))
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+	client := rpc.DialHTTP(context.Background(), URL, jsonrpc.NewClientCodec)
+	client.Retry = &rpc.RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond, Idempotent: []string{"flaky.get"}}
+	client.Breaker = &rpc.CircuitBreaker{FailureThreshold: 1, OpenTimeout: time.Hour}
+	endpoint := &rpc.Endpoint{Name: "a", Client: client}
+	balancer := rpc.NewBalancer(endpoint)
+	ctx := context.Background()
+
+	// 参数无法编码,请求没有发送
+	var ee *rpc.EncodeError
+	if err := balancer.Call(ctx, "flaky.get", nil, make(chan int)); !errors.As(err, &ee) || rpc.IsTransportError(err) {
+		t.Fatalf("want EncodeError, got %v", err)
+	}
+	if n := atomic.LoadInt64(&requests); n != 0 {
+		t.Fatalf("want no request, got %d", n)
+	}
+	if !endpoint.Healthy() || client.Breaker.State("") != rpc.CircuitClosed {
+		t.Fatal("encode error counted as transport failure")
+	}
+
+	// 结果类型不匹配
+	var result int
+	var re *rpc.ResultError
+	if err := balancer.Call(ctx, "flaky.get", &result); !errors.As(err, &re) || rpc.IsTransportError(err) {
+		t.Fatalf("want ResultError, got %v", err)
+	}
+	if n := atomic.LoadInt64(&requests); n != 1 {
+		t.Fatalf("want 1 request, got %d", n)
+	}
+	if !endpoint.Healthy() || client.Breaker.State("") != rpc.CircuitClosed {
+		t.Fatal("result error counted as transport failure")
+	}
+}
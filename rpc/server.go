@@ -2,42 +2,112 @@ package rpc
 
 import (
 	"context"
+	"crypto/subtle"
 	"io"
 	"net"
 	"net/http"
+	"sync"
 	"sync/atomic"
 
+	"github.com/smallsung/gopkg/errors"
 	"go.uber.org/zap"
 )
 
 type NewServerCodecFunc func(io.ReadWriteCloser) ServerCodec
 
+const (
+	// DebugErrorHeader 携带 Server.DebugErrorToken 的 HTTP 请求头
+	DebugErrorHeader = "X-Rpc-Debug-Token"
+	// RequestIDHeader HTTP 请求通过它传递请求ID,响应时原样返回
+	RequestIDHeader = "X-Request-Id"
+)
+
 type Server struct {
 	running uint32
 
 	Logger *zap.Logger
+	// Metrics 为 nil 时不记录监控指标
+	Metrics *ServerMetrics
+	// Tracer 为 nil 时不记录 Span, 但仍然向回调传递请求的追踪上下文
+	Tracer *Tracer
+
+	// DebugError 所有错误响应包含完整的错误链(文件,行号,PC).只应该在调试时开启
+	DebugError bool
+	// DebugErrorToken 非空时,请求头 DebugErrorHeader 与之相等的 HTTP 请求可以获得完整的错误链
+	DebugErrorToken string
+
+	// OnConnect 在 ServeCodec 开始处理连接时调用
+	OnConnect func(conn *Connection)
+	// OnDisconnect 在连接关闭后调用, err 是导致连接关闭的读取错误
+	OnDisconnect func(conn *Connection, err error)
+	// OnServiceChange 在 Register, Unregister, Replace 成功之后调用
+	OnServiceChange func(change ServiceChange)
+
+	// Naming 为 nil 时使用 NamingLowerFirst. 只影响之后注册的服务
+	Naming NamingPolicy
+	// Separator 连接命名空间与方法名,为空时使用 MethodSeparator. 例如 "_" 兼容 Ethereum 风格的 "eth_blockNumber".
+	// 内置的 rpc 命名空间始终可以通过 MethodSeparator 调用
+	Separator string
+
+	// MediaType NewServer 的编解码器的 HTTP 媒体类型. 调用 RegisterCodec 之后,
+	// Content-Type 为 MediaType 的请求仍然使用 NewServer 的编解码器. 为空时只接受已注册的媒体类型
+	MediaType string
 
 	newCodec NewServerCodecFunc
+	// notifications 为 true 时执行所有通知的回调, 否则只执行内置 rpc 命名空间的通知
+	notifications bool
 
-	codecCount uint64
-	codecs     map[uint64]ServerCodec
+	mu              sync.Mutex
+	codecs          map[string]NewServerCodecFunc
+	connectionCount uint64
+	connections     map[uint64]*Connection
 
 	registry registry
 }
 
 func NewServer(newCodecFunc NewServerCodecFunc) *Server {
 	s := &Server{
-		running:  1,
-		Logger:   zap.NewNop(),
-		newCodec: newCodecFunc,
-		codecs:   make(map[uint64]ServerCodec),
+		running:     1,
+		Logger:      zap.NewNop(),
+		newCodec:    newCodecFunc,
+		connections: make(map[uint64]*Connection),
 	}
 	_ = s.Register(builtinServiceName, builtinService{s})
 	return s
 }
 
-func (s *Server) Register(namespaces string, receiver interface{}) error {
-	return s.registry.register(namespaces, receiver)
+// Register 注册 receiver 的所有导出方法, opts 作用于所有方法, 使用 ForMethod 指定单个方法的选项
+func (s *Server) Register(namespaces string, receiver interface{}, opts ...MethodOption) error {
+	if err := s.checkNamespace(namespaces); err != nil {
+		return err
+	}
+	cbs, err := receiverCallbacks(namespaces, receiver, s.naming(), opts)
+	if err != nil {
+		return err
+	}
+	revision, err := s.registry.register(namespaces, cbs)
+	if err != nil {
+		return err
+	}
+	s.serviceChanged(ServiceChange{Revision: revision, Namespace: namespaces, Kind: ServiceRegistered})
+	return nil
+}
+
+// RegisterFunc 以 namespace.method 注册函数 fn. 闭包与方法值的名称无法可靠推导,需要使用 RegisterFunc 注册
+func (s *Server) RegisterFunc(namespace, method string, fn interface{}, opts ...MethodOption) error {
+	if err := s.checkNamespace(namespace); err != nil {
+		return err
+	}
+	cbs, err := funcCallbacks(namespace, method, fn, opts)
+	if err != nil {
+		return err
+	}
+	revision, err := s.registry.register(namespace, cbs)
+	if err != nil {
+		return err
+	}
+	s.serviceChanged(ServiceChange{Revision: revision, Namespace: namespace, Kind: ServiceRegistered})
+	return nil
 }
 
 func (s *Server) Accept(listener net.Listener) {
@@ -53,29 +123,80 @@ func (s *Server) Accept(listener net.Listener) {
 }
 
 func (s *Server) ServeConn(ctx context.Context, conn io.ReadWriteCloser) {
+	if c, ok := conn.(net.Conn); ok {
+		p := Peer{Transport: c.LocalAddr().Network()}
+		if addr := c.RemoteAddr(); addr != nil {
+			p.RemoteAddr = addr.String()
+		}
+		ctx = withPeer(ctx, p)
+	}
 	codec := s.newCodec(conn)
 	s.ServeCodec(ctx, codec)
 }
 
+// ServeCodec 处理连接上的所有请求,直到对端断开,读取失败或者服务关闭. 返回前关闭 codec
 func (s *Server) ServeCodec(ctx context.Context, codec ServerCodec) {
 	defer codec.Close()
-	if atomic.LoadUint32(&s.running) == 0 {
+	conn := s.addConnection(ctx, codec)
+	if conn == nil {
 		return
 	}
-	s.codecs[atomic.AddUint64(&s.codecCount, 1)] = codec
 
-	baseCtx := ctx
+	// 连接关闭后取消所有正在执行的回调
+	ctx, cancel := context.WithCancel(withConnection(ctx, conn))
+	defer cancel()
+	if dc, ok := codec.(DuplexServerCodec); ok {
+		conn.reverse = newReverseClientCodec(dc)
+		conn.client = NewClient(conn.reverse)
+		conn.client.Logger = s.Logger
+		ctx = context.WithValue(ctx, clientContextKey, conn.client)
+	}
+
+	logger := s.Logger.With(zap.Uint64("connection", conn.ID), zap.String("transport", conn.Peer.Transport))
+	logger.Debug("server.connect", zap.String("remoteAddr", conn.Peer.RemoteAddr))
+	s.Metrics.connectionOpened(conn.Peer.Transport)
+	if s.OnConnect != nil {
+		s.OnConnect(conn)
+	}
+
+	err := s.serveConnection(ctx, conn)
+	if conn.client != nil {
+		conn.client.Close()
+	}
+
+	s.removeConnection(conn)
+	s.Metrics.connectionClosed(conn.Peer.Transport)
+	logger.Debug("server.disconnect", zap.Error(err))
+	if s.OnDisconnect != nil {
+		s.OnDisconnect(conn, err)
+	}
+	conn.session.close()
+}
+
+func (s *Server) serveConnection(ctx context.Context, conn *Connection) error {
+	codec := conn.codec
 	for {
-		var err error
-		var raw RawMessage
-		if raw, err = s.readRequest(codec); err != nil {
+		raw, err := s.readRequest(codec)
+		switch {
+		case err == nil:
+		case atomic.LoadUint32(&s.running) == 0 || isClosedError(err):
+			return err
+		case isRecoverableError(err):
 			s.Logger.Warn("codec.ReadRequest", zap.Error(err))
+			_, _ = s.writeErrorResponse(codec, ErrParseError)
+			continue
+		default:
+			// 编解码器无法跳过错误的消息,继续读取只会得到相同的错误
+			s.Logger.Warn("codec.ReadRequest", zap.Error(err))
+			_, _ = s.writeErrorResponse(codec, ErrParseError)
+			return err
+		}
+		if conn.reverse != nil && conn.reverse.IsResponse(raw) {
+			conn.reverse.deliver(raw)
 			continue
 		}
-		ctx = context.WithValue(baseCtx, "", raw)
 		go s.serveRequest(ctx, codec, raw)
 	}
-
 }
 
 //ServeRequest 处理单次，不会关闭连接
@@ -87,9 +208,9 @@ func (s *Server) ServeRequest(ctx context.Context, codec ServerCodec) (err error
 	var raw []byte
 	if raw, err = s.readRequest(codec); err != nil {
 		s.Logger.Warn("codec.ReadRequest", zap.Error(err))
+		_, _ = s.writeErrorResponse(codec, ErrParseError)
 		return err
 	}
-	ctx = context.WithValue(ctx, "", raw)
 	return s.serveRequest(ctx, codec, raw)
 }
 
@@ -101,10 +222,33 @@ func (s *Server) ServeHTTP(response http.ResponseWriter, request *http.Request)
 	default:
 	}
 
+	ctx = withPeer(ctx, Peer{Transport: "http", RemoteAddr: request.RemoteAddr, HTTPHeader: request.Header})
+	if id := request.Header.Get(RequestIDHeader); validRequestID(id) {
+		ctx = context.WithValue(ctx, requestIDContextKey, id)
+	} else {
+		ctx = context.WithValue(ctx, requestIDContextKey, newCorrelationID())
+	}
+	response.Header().Set(RequestIDHeader, RequestIDFromContext(ctx))
+	if sc, err := ParseTraceParent(request.Header.Get(TraceParentHeader)); err == nil {
+		ctx = ContextWithSpanContext(ctx, sc)
+	}
+
+	if s.DebugErrorToken != "" {
+		token := request.Header.Get(DebugErrorHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.DebugErrorToken)) == 1 {
+			ctx = WithDebugError(ctx)
+		}
+	}
+
+	newCodec, ok := s.negotiate(response, request)
+	if !ok {
+		return
+	}
+
 	conn := &httpServerConn{response: response, request: request}
-	codec := s.newCodec(conn)
+	codec := newCodec(conn)
 	defer codec.Close()
-	if err := s.ServeRequest(request.Context(), codec); err != nil {
+	if err := s.ServeRequest(ctx, codec); err != nil {
 		s.Logger.Warn("server.ServeHTTP", zap.Error(err))
 	}
 }
@@ -112,15 +256,16 @@ func (s *Server) ServeHTTP(response http.ResponseWriter, request *http.Request)
 func (s *Server) Shutdown() {
 	if atomic.CompareAndSwapUint32(&s.running, 1, 0) {
 		s.Logger.Info("rpc server shutting down")
-		for _, codec := range s.codecs {
-			_ = codec.Close()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, conn := range s.connections {
+			_ = conn.codec.Close()
 		}
 	}
 }
 
 func (s *Server) readRequest(codec ServerCodec) (raw []byte, err error) {
 	if raw, err = codec.ReadRequest(); err != nil {
-		_ = s.writeErrorResponse(codec, ErrParseError)
 		return nil, err
 	}
 	s.Logger.Debug("server.readRequest", zap.String("raw", string(raw)))
@@ -136,28 +281,44 @@ func (s *Server) unmarshalRequest(codec ServerCodec, raw []byte) (*RequestMessag
 	}
 }
 
-func (s *Server) writeErrorResponse(codec ServerCodec, err error) error {
+func (s *Server) writeErrorResponse(codec ServerCodec, err error) (int, error) {
 	return s.writeResponse(codec, NewResponseMessages(errorResponseMessage(err)))
 }
 
-func (s *Server) writeResponse(codec ServerCodec, responses *ResponseMessages) (err error) {
+func (s *Server) writeResponse(codec ServerCodec, responses *ResponseMessages) (size int, err error) {
 	var raw []byte
 	if raw, err = s.marshalResponse(codec, responses); err == nil {
 		if err = codec.WriteResponse(raw); err != nil {
 			s.Logger.Debug("codec.WriteResponse", zap.Error(err))
-			return err
+			return 0, err
 		}
-		return nil
+		return len(raw), nil
 	}
 	// 对于编码错误的情况，向客户端反馈。  ErrInternalError
 	// 对于确定的结构体，确定的值，这里不应该会出现错误。
 	if raw, err := s.marshalResponse(codec, NewResponseMessages(errorResponseMessage(ErrInternalError))); err == nil {
 		if err := codec.WriteResponse(raw); err != nil {
 			s.Logger.Debug("codec.WriteResponse", zap.Error(err))
+		} else {
+			size = len(raw)
 		}
 	}
 
-	return err
+	return size, err
+}
+
+// errorMessage 回调错误的响应.完整的错误信息只记录在服务端日志中,通过 MessageError.ErrorID 关联
+func (s *Server) errorMessage(ctx context.Context, request *RequestMessage, err error) *ResponseMessage {
+	id := newCorrelationID()
+	s.logger(ctx).Warn("server.callback",
+		zap.String("errorId", id),
+		zap.String("method", request.Method),
+		zap.String("details", errors.Details(err)),
+	)
+
+	me := newMessageError(err, s.DebugError || isDebugError(ctx))
+	me.ErrorID = id
+	return &ResponseMessage{ID: request.ID, Error: me}
 }
 
 func (s *Server) marshalResponse(codec ServerCodec, responses *ResponseMessages) ([]byte, error) {
@@ -169,26 +330,36 @@ func (s *Server) marshalResponse(codec ServerCodec, responses *ResponseMessages)
 	}
 }
 
-func (s *Server) serveRequest(ctx context.Context, codec ServerCodec, raw []byte) error {
+func (s *Server) serveRequest(ctx context.Context, codec ServerCodec, raw []byte) (err error) {
+	ctx = s.withRequestID(ctx)
+	access := newAccessLog(ctx)
+	defer s.logAccess(ctx, access)
+
 	requests, err := s.unmarshalRequest(codec, raw)
 	//包含空数组的rpc调用:
 	//--> []
 	//<-- {"rpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}
 	if err != nil || len(requests.Elems) == 0 {
-		_ = s.writeErrorResponse(codec, ErrInvalidRequest)
+		access.codes = append(access.codes, ErrInvalidRequest.code)
+		access.size, _ = s.writeErrorResponse(codec, ErrInvalidRequest)
 		return ErrInvalidRequest
 	}
+	access.request(requests)
+	if requests.Batch {
+		s.Metrics.batch(access.peer.Transport, len(requests.Elems))
+	}
 
-	ctx = context.WithValue(ctx, "", requests)
 	h := &handler{
-		registry: &s.registry,
-		codec:    codec,
+		server: s,
+		codec:  codec,
 	}
 	responses := h.handleMessages(ctx, requests)
+	access.response(responses)
 
 	if len(responses.Elems) == 0 {
 		return nil
 	}
 
-	return s.writeResponse(codec, responses)
+	access.size, err = s.writeResponse(codec, responses)
+	return err
 }
@@ -0,0 +1,80 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/smallsung/gopkg/errors"
+	"go.uber.org/zap"
+)
+
+// servicesChangedMethod 服务变化时向支持双向调用的连接发送的通知
+const servicesChangedMethod = builtinServiceName + MethodSeparator + "servicesChanged"
+
+const (
+	ServiceRegistered   = "registered"
+	ServiceUnregistered = "unregistered"
+	ServiceReplaced     = "replaced"
+)
+
+// ServiceChange 服务的变化. Revision 与 rpc.revision 的结果相同,可以用来丢弃过期的通知
+type ServiceChange struct {
+	Revision  uint64 `json:"revision"`
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+}
+
+// Unregister 移除命名空间中的所有方法. 正在执行的调用不受影响,之后的调用返回 ErrMethodNotFound
+func (s *Server) Unregister(namespace string) error {
+	if namespace == builtinServiceName {
+		return errors.Format("namespace %s is reserved", namespace)
+	}
+	revision, err := s.registry.unregister(namespace)
+	if err != nil {
+		return err
+	}
+	s.serviceChanged(ServiceChange{Revision: revision, Namespace: namespace, Kind: ServiceUnregistered})
+	return nil
+}
+
+// Replace 用 receiver 替换命名空间中的所有方法. 正在执行的调用继续使用原来的 receiver
+func (s *Server) Replace(namespace string, receiver interface{}, opts ...MethodOption) error {
+	if namespace == builtinServiceName {
+		return errors.Format("namespace %s is reserved", namespace)
+	}
+	if err := s.checkNamespace(namespace); err != nil {
+		return err
+	}
+	cbs, err := receiverCallbacks(namespace, receiver, s.naming(), opts)
+	if err != nil {
+		return err
+	}
+	revision, err := s.registry.replace(namespace, cbs)
+	if err != nil {
+		return err
+	}
+	s.serviceChanged(ServiceChange{Revision: revision, Namespace: namespace, Kind: ServiceReplaced})
+	return nil
+}
+
+func (s *Server) serviceChanged(change ServiceChange) {
+	if s.OnServiceChange != nil {
+		s.OnServiceChange(change)
+	}
+	for _, conn := range s.Connections() {
+		if conn.client == nil {
+			continue
+		}
+		go func(client *Client) {
+			if err := client.Notice(context.Background(), servicesChangedMethod, change); err != nil {
+				s.Logger.Debug("server.serviceChanged", zap.Error(err))
+			}
+		}(conn.client)
+	}
+}
+
+// ServicesChanged 服务端的服务变化时调用 Client.OnServiceChange
+func (s clientBuiltinService) ServicesChanged(change ServiceChange) {
+	if s.client.OnServiceChange != nil {
+		s.client.OnServiceChange(change)
+	}
+}
@@ -0,0 +1,90 @@
+package rpc_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+type versionService struct {
+	version string
+}
+
+func (s versionService) Version() string {
+	return s.version
+}
+
+func TestUnregisterReplace(t *testing.T) {
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	var mu sync.Mutex
+	var changes []rpc.ServiceChange
+	server.OnServiceChange = func(change rpc.ServiceChange) {
+		mu.Lock()
+		changes = append(changes, change)
+		mu.Unlock()
+	}
+	if err := server.Register("app", versionService{"v1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	notified := make(chan rpc.ServiceChange, 4)
+	client := rpc.DialInProc(context.Background(), server, jsonrpc.NewClientCodec)
+	defer client.Close()
+	client.OnServiceChange = func(change rpc.ServiceChange) { notified <- change }
+
+	ctx := context.Background()
+	var version string
+	if err := client.Call(ctx, "app.version", &version); err != nil || version != "v1" {
+		t.Fatalf("version: %q, %v", version, err)
+	}
+
+	if err := server.Replace("app", versionService{"v2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(ctx, "app.version", &version); err != nil || version != "v2" {
+		t.Fatalf("version: %q, %v", version, err)
+	}
+	select {
+	case change := <-notified:
+		if change.Namespace != "app" || change.Kind != rpc.ServiceReplaced {
+			t.Fatalf("unexpected change %+v", change)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no servicesChanged notification")
+	}
+
+	if err := server.Unregister("app"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(ctx, "app.version", &version); err == nil {
+		t.Fatal("call unregistered method succeeded")
+	}
+	var modules []string
+	if err := client.Call(ctx, "rpc.modules", &modules); err != nil {
+		t.Fatal(err)
+	}
+	if len(modules) != 1 || modules[0] != "rpc" {
+		t.Fatalf("modules: %v", modules)
+	}
+	var revision uint64
+	if err := client.Call(ctx, "rpc.revision", &revision); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Unregister("app"); err == nil {
+		t.Fatal("unregister twice succeeded")
+	}
+	if err := server.Unregister("rpc"); err == nil {
+		t.Fatal("unregister builtin namespace succeeded")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(changes) != 3 || changes[2].Kind != rpc.ServiceUnregistered || changes[2].Revision != revision {
+		t.Fatalf("changes: %+v, revision %d", changes, revision)
+	}
+}
@@ -0,0 +1,75 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+)
+
+// Session 流式连接的会话状态,连接关闭时释放.
+// 服务可以用它实现一次登录多次调用,或者管理连接级别的资源
+type Session struct {
+	mu      sync.Mutex
+	values  map[interface{}]interface{}
+	closers []func()
+	closed  bool
+}
+
+func newSession() *Session {
+	return &Session{values: make(map[interface{}]interface{})}
+}
+
+func (s *Session) Get(key interface{}) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	return value, ok
+}
+
+func (s *Session) Set(key, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+}
+
+func (s *Session) Delete(key interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+}
+
+// OnClose 注册连接关闭时执行的函数,按注册的相反顺序执行.
+// 会话已经关闭时立即执行
+func (s *Session) OnClose(fn func()) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		fn()
+		return
+	}
+	s.closers = append(s.closers, fn)
+	s.mu.Unlock()
+}
+
+func (s *Session) close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	closers := s.closers
+	s.closers, s.values = nil, make(map[interface{}]interface{})
+	s.mu.Unlock()
+
+	for i := len(closers) - 1; i >= 0; i-- {
+		closers[i]()
+	}
+}
+
+// SessionFromContext 返回请求所在连接的会话, HTTP 请求返回 nil
+func SessionFromContext(ctx context.Context) *Session {
+	if conn := ConnectionFromContext(ctx); conn != nil {
+		return conn.session
+	}
+	return nil
+}
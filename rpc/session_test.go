@@ -0,0 +1,71 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+type sessionKey struct{}
+
+type sessionService struct {
+	logout chan string
+}
+
+func (s sessionService) Login(ctx context.Context, user string) error {
+	session := rpc.SessionFromContext(ctx)
+	if session == nil {
+		return errors.New("no session")
+	}
+	session.Set(sessionKey{}, user)
+	session.OnClose(func() { s.logout <- user })
+	return nil
+}
+
+func (sessionService) Whoami(ctx context.Context) string {
+	user, _ := rpc.SessionFromContext(ctx).Get(sessionKey{})
+	name, _ := user.(string)
+	return name
+}
+
+func TestSession(t *testing.T) {
+	ctx := context.Background()
+	service := sessionService{logout: make(chan string, 2)}
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("session", service); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := rpc.DialInProc(ctx, server, jsonrpc.NewClientCodec)
+	bob := rpc.DialInProc(ctx, server, jsonrpc.NewClientCodec)
+	defer bob.Close()
+	if err := alice.Call(ctx, "session.login", nil, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一个连接上的调用共享会话,不同连接之间相互隔离
+	for i := 0; i < 2; i++ {
+		var name string
+		if err := alice.Call(ctx, "session.whoami", &name); err != nil || name != "alice" {
+			t.Fatalf("alice: got %q %v", name, err)
+		}
+	}
+	var name string
+	if err := bob.Call(ctx, "session.whoami", &name); err != nil || name != "" {
+		t.Fatalf("bob: got %q %v", name, err)
+	}
+
+	alice.Close()
+	select {
+	case user := <-service.logout:
+		if user != "alice" {
+			t.Fatalf("want alice, got %s", user)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session was not closed with the connection")
+	}
+}
@@ -0,0 +1,69 @@
+package rpc
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/smallsung/gopkg/errors"
+)
+
+// streamMethod 服务端发送回调返回的 channel 中的值
+const streamMethod = builtinServiceName + MethodSeparator + "stream"
+
+// drainStream 读取回调返回的 channel 直到关闭或者 ctx 结束. 回调发送值时应该同时等待 ctx.Done(), 否则 ctx 结束后会一直阻塞.
+// 支持双向调用的连接逐个发送 rpc.stream 通知,调用的结果为 null. 其他情况收集为数组作为调用的结果
+func (s *Server) drainStream(ctx context.Context, request *RequestMessage, ch interface{}) (interface{}, error) {
+	var client *Client
+	if conn := ConnectionFromContext(ctx); conn != nil && !request.IsNotification() {
+		client = conn.client
+	}
+	values := make([]interface{}, 0)
+	rv := reflect.ValueOf(ch)
+	if rv.IsNil() {
+		return values, nil
+	}
+
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		{Dir: reflect.SelectRecv, Chan: rv},
+	}
+	for {
+		chosen, value, ok := reflect.Select(cases)
+		if chosen == 0 {
+			return nil, errors.Trace(ctx.Err())
+		}
+		if !ok {
+			break
+		}
+		if client == nil {
+			values = append(values, value.Interface())
+			continue
+		}
+		if err := client.Notice(ctx, streamMethod, decodeMessageID(request.ID), value.Interface()); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	if client != nil {
+		return nil, nil
+	}
+	return values, nil
+}
+
+// StreamHandler 处理回调返回的 channel 中的值. 按照发送的顺序调用,全部调用之后才返回调用的结果
+type StreamHandler func(v PartialResult)
+
+// WithStreamHandler 通过 ctx 发起的调用收到 rpc.stream 通知时调用 handler.
+// 只支持流式连接,没有设置 handler 时这些值被丢弃
+func WithStreamHandler(ctx context.Context, handler StreamHandler) context.Context {
+	return context.WithValue(ctx, streamHandlerContextKey, handler)
+}
+
+func streamHandlerFromContext(ctx context.Context) StreamHandler {
+	handler, _ := ctx.Value(streamHandlerContextKey).(StreamHandler)
+	return handler
+}
+
+// Stream 调用已经结束或者没有设置 StreamHandler 时忽略
+func (s clientBuiltinService) Stream(id interface{}, value interface{}) error {
+	return s.client.streams.deliver(s.client, id, value)
+}
@@ -0,0 +1,242 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smallsung/gopkg/errors"
+)
+
+// TraceParentHeader W3C Trace Context 的 HTTP 请求头
+const TraceParentHeader = "traceparent"
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (id TraceID) IsValid() bool                { return id != TraceID{} }
+func (id TraceID) String() string               { return hex.EncodeToString(id[:]) }
+func (id TraceID) MarshalText() ([]byte, error) { return []byte(id.String()), nil }
+func (id SpanID) IsValid() bool                 { return id != SpanID{} }
+func (id SpanID) String() string                { return hex.EncodeToString(id[:]) }
+func (id SpanID) MarshalText() ([]byte, error)  { return []byte(id.String()), nil }
+
+// SpanContext 跨进程传递的追踪上下文
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// TraceParent 格式化为 W3C traceparent: version-traceid-spanid-flags
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceParent 解析 W3C traceparent
+func ParseTraceParent(traceParent string) (sc SpanContext, err error) {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, errors.Format("invalid traceparent %q", traceParent)
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errors.Format("invalid traceparent %q", traceParent)
+	}
+	// W3C 要求小写的十六进制
+	for _, part := range parts[:4] {
+		if !isLowerHex(part) {
+			return sc, errors.Format("invalid traceparent %q", traceParent)
+		}
+	}
+	var flags [1]byte
+	if _, err = hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, errors.Annotate(err, "invalid traceparent %q", traceParent)
+	}
+	if _, err = hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, errors.Annotate(err, "invalid traceparent %q", traceParent)
+	}
+	if _, err = hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, errors.Annotate(err, "invalid traceparent %q", traceParent)
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, errors.Format("invalid traceparent %q", traceParent)
+	}
+	sc.Sampled = flags[0]&0x01 == 0x01
+	return sc, nil
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ContextWithSpanContext rpc.Client 会将 ctx 中的 SpanContext 传递给服务端
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey, sc)
+}
+
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey).(SpanContext)
+	return sc
+}
+
+type Span struct {
+	Name       string            `json:"name"`
+	Context    SpanContext       `json:"-"`
+	Parent     SpanContext       `json:"-"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+
+	tracer *Tracer
+	once   sync.Once
+}
+
+func (span *Span) SetAttribute(key, value string) {
+	if span == nil {
+		return
+	}
+	if span.Attributes == nil {
+		span.Attributes = make(map[string]string)
+	}
+	span.Attributes[key] = value
+}
+
+// Finish 结束并导出 Span. 只有第一次调用有效
+func (span *Span) Finish(err error) {
+	if span == nil {
+		return
+	}
+	span.once.Do(func() {
+		span.End = time.Now()
+		if err != nil {
+			span.Error = err.Error()
+		}
+		if span.Context.Sampled && span.tracer.Exporter != nil {
+			span.tracer.Exporter.ExportSpan(span)
+		}
+	})
+}
+
+func (span *Span) MarshalJSON() ([]byte, error) {
+	type spanJSON Span
+	v := struct {
+		*spanJSON
+		TraceID      TraceID `json:"traceId"`
+		SpanID       SpanID  `json:"spanId"`
+		ParentSpanID string  `json:"parentSpanId,omitempty"`
+		Duration     float64 `json:"durationMs"`
+	}{
+		spanJSON: (*spanJSON)(span),
+		TraceID:  span.Context.TraceID,
+		SpanID:   span.Context.SpanID,
+		Duration: float64(span.End.Sub(span.Start)) / float64(time.Millisecond),
+	}
+	if span.Parent.SpanID.IsValid() {
+		v.ParentSpanID = span.Parent.SpanID.String()
+	}
+	return json.Marshal(v)
+}
+
+// SpanExporter 导出已结束的 Span
+type SpanExporter interface {
+	ExportSpan(span *Span)
+}
+
+type Tracer struct {
+	Exporter SpanExporter
+}
+
+func NewTracer(exporter SpanExporter) *Tracer {
+	return &Tracer{Exporter: exporter}
+}
+
+// Start 以 ctx 中的 SpanContext 作为父级开始新的 Span, 返回的 ctx 包含新 Span 的 SpanContext.
+// ctx 中没有 SpanContext 时开始新的追踪
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+	span := &Span{Name: name, Parent: parent, Start: time.Now(), tracer: t}
+	if parent.IsValid() {
+		span.Context.TraceID, span.Context.Sampled = parent.TraceID, parent.Sampled
+	} else {
+		_, _ = rand.Read(span.Context.TraceID[:])
+		span.Context.Sampled = true
+	}
+	_, _ = rand.Read(span.Context.SpanID[:])
+	return ContextWithSpanContext(ctx, span.Context), span
+}
+
+// MemoryExporter 在内存中保存导出的 Span, 用于本地测试
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *MemoryExporter) ExportSpan(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func (e *MemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+func (e *MemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// JSONExporter 每个 Span 输出一行 JSON, NewJSONExporter(os.Stdout) 用于本地调试
+type JSONExporter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewJSONExporter(writer io.Writer) *JSONExporter {
+	return &JSONExporter{encoder: json.NewEncoder(writer)}
+}
+
+func (e *JSONExporter) ExportSpan(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_ = e.encoder.Encode(span)
+}
+
+// startCallbackSpan 在回调的 ctx 中传递请求的追踪上下文, Server.Tracer 不为 nil 时开始服务端 Span
+func (s *Server) startCallbackSpan(ctx context.Context, request *RequestMessage) (context.Context, *Span) {
+	if request.TraceParent != "" {
+		if sc, err := ParseTraceParent(request.TraceParent); err == nil {
+			ctx = ContextWithSpanContext(ctx, sc)
+		}
+	}
+	if s.Tracer == nil {
+		return ctx, nil
+	}
+	ctx, span := s.Tracer.Start(ctx, request.Method)
+	span.SetAttribute("rpc.method", request.Method)
+	span.SetAttribute("rpc.transport", PeerFromContext(ctx).Transport)
+	span.SetAttribute("rpc.requestId", RequestIDFromContext(ctx))
+	return ctx, span
+}
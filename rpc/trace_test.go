@@ -0,0 +1,94 @@
+package rpc_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+type traceService struct{}
+
+// TraceParent 返回回调 ctx 中的追踪上下文
+func (traceService) TraceParent(ctx context.Context) string {
+	return rpc.SpanContextFromContext(ctx).TraceParent()
+}
+
+func TestParseTraceParent(t *testing.T) {
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := rpc.ParseTraceParent(traceParent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected span context %+v", sc)
+	}
+	if sc.TraceParent() != traceParent {
+		t.Fatalf("want %s, got %s", traceParent, sc.TraceParent())
+	}
+	for _, invalid := range []string{
+		"",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00F067AA0BA902B7-01",
+		"0A-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, err := rpc.ParseTraceParent(invalid); err == nil {
+			t.Fatalf("%q: want error", invalid)
+		}
+	}
+}
+
+func TestTracePropagation(t *testing.T) {
+	ctx := context.Background()
+	exporter := new(rpc.MemoryExporter)
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	server.Tracer = rpc.NewTracer(exporter)
+	if err := server.Register("trace", traceService{}); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	URL, _ := url.Parse(httpServer.URL)
+
+	clientTracer := rpc.NewTracer(nil)
+	// HTTP 通过请求头传递, 流式连接通过消息中的 traceparent 字段传递
+	for transport, client := range map[string]*rpc.Client{
+		"http": rpc.DialHTTP(ctx, URL, jsonrpc.NewClientCodec),
+		"pipe": rpc.DialInProc(ctx, server, jsonrpc.NewClientCodec),
+	} {
+		exporter.Reset()
+		callCtx, clientSpan := clientTracer.Start(ctx, "client")
+		var traceParent string
+		if err := client.Call(callCtx, "trace.traceParent", &traceParent); err != nil {
+			t.Fatal(err)
+		}
+		client.Close()
+
+		spans := exporter.Spans()
+		if len(spans) != 1 {
+			t.Fatalf("%s: want 1 span, got %d", transport, len(spans))
+		}
+		span := spans[0]
+		if span.Name != "trace.traceParent" || span.Attributes["rpc.transport"] != transport {
+			t.Fatalf("%s: unexpected span %+v", transport, span)
+		}
+		if span.Context.TraceID != clientSpan.Context.TraceID || span.Parent.SpanID != clientSpan.Context.SpanID {
+			t.Fatalf("%s: server span %+v is not a child of %+v", transport, span, clientSpan.Context)
+		}
+		if span.Context.SpanID == clientSpan.Context.SpanID || span.End.Before(span.Start) {
+			t.Fatalf("%s: unexpected server span %+v", transport, span)
+		}
+		// 回调中的追踪上下文是服务端 Span
+		if traceParent != span.Context.TraceParent() {
+			t.Fatalf("%s: callback got %s, want %s", transport, traceParent, span.Context.TraceParent())
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 type RawMessage = []byte
 
 type (
+	// MessageID 请求ID的 JSON 文本,如 1 或者 "a". 其他编码方式的编解码器需要转换为相同的形式
 	MessageID     = RawMessage
 	MessageMethod = string
 	MessageParams = RawMessage
@@ -15,6 +16,8 @@ type (
 		Code    int64
 		Message string
 		Data    interface{}
+		// ErrorID 服务端返回错误时生成, 与服务端日志关联
+		ErrorID string
 	}
 )
 
@@ -22,6 +25,9 @@ type RequestMessage struct {
 	ID     MessageID
 	Method MessageMethod
 	Params MessageParams
+
+	// TraceParent 可选的 W3C traceparent, 流式传输时由客户端填充
+	TraceParent string
 }
 
 type ResponseMessage struct {
@@ -40,6 +46,13 @@ type ResponseMessages struct {
 	Elems []*ResponseMessage
 }
 
+// RecoverableError ServerCodec.ReadRequest 返回的错误实现该接口并且 Recoverable 返回 true 时,
+// 表示编解码器已经跳过错误的消息,可以继续读取下一条消息. 否则读取失败后连接会被关闭
+type RecoverableError interface {
+	error
+	Recoverable() bool
+}
+
 type ServerCodec interface {
 	ReadRequest() (RawMessage, error)
 	UnmarshalRequest(RawMessage) (*RequestMessages, error)
@@ -59,3 +72,30 @@ type ClientCodec interface {
 	ReadResponse() (RawMessage, error)
 	Close() error
 }
+
+// ContentTyper 编解码器实现该接口时, HTTP 客户端使用它作为请求的 Content-Type 和 Accept
+type ContentTyper interface {
+	ContentType() string
+}
+
+// DuplexServerCodec 服务端可以通过同一个连接调用客户端注册的方法.
+// ReadRequest 读取到的消息可能是客户端对这些调用的响应,由 IsResponse 区分
+type DuplexServerCodec interface {
+	ServerCodec
+	IsResponse(RawMessage) bool
+	MarshalRequestParams(...interface{}) (MessageParams, error)
+	MarshalRequest(*RequestMessages) (RawMessage, error)
+	UnmarshalResponse(RawMessage) (*ResponseMessages, error)
+	UnmarshalResponseResult(MessageResult, interface{}) error
+}
+
+// DuplexClientCodec 客户端可以处理服务端通过同一个连接发起的调用.
+// ReadResponse 读取到的消息可能是服务端的请求,由 IsRequest 区分
+type DuplexClientCodec interface {
+	ClientCodec
+	IsRequest(RawMessage) bool
+	UnmarshalRequest(RawMessage) (*RequestMessages, error)
+	UnmarshalRequestParams(MessageParams, Ins) ([]reflect.Value, error)
+	MarshalResponseResult(interface{}) (MessageResult, error)
+	MarshalResponse(*ResponseMessages) (RawMessage, error)
+}
@@ -0,0 +1,404 @@
+package rpc
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/smallsung/gopkg/errors"
+)
+
+// ValidateTag 参数类型的字段通过这个标签声明校验规则,多个规则以 ',' 分隔:
+//
+//	required       非零值
+//	min=N, max=N   数值的大小,字符串,切片,映射的长度
+//	enum=a|b|c     字符串或者整数必须是其中之一. 比较底层的值,不使用 String 方法
+//	regex=pattern  字符串匹配正则表达式. pattern 可以包含 ',', 所以必须是最后一个规则
+//
+// 指针字段为 nil 时只检查 required. 嵌套的结构体,结构体的指针,切片,映射的值同样会被校验
+const ValidateTag = "validate"
+
+// FieldError 一个字段校验失败的原因. Field 使用 json 标签的名称,如 "params[0].items[1].name"
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// InvalidParamsError 参数校验失败. 错误码与 ErrInvalidParams 相同, 错误数据是 []FieldError
+type InvalidParamsError struct {
+	errors.Err
+	Fields []FieldError
+}
+
+func (err *InvalidParamsError) RPCErrorCode() int64       { return ErrInvalidParams.code }
+func (err *InvalidParamsError) RPCErrorMessage() string   { return err.Error() }
+func (err *InvalidParamsError) RPCErrorData() interface{} { return err.Fields }
+func (err *InvalidParamsError) Is(target error) bool      { return target == error(ErrInvalidParams) }
+
+func newInvalidParamsError(fields []FieldError) *InvalidParamsError {
+	messages := make([]string, 0, len(fields))
+	for _, field := range fields {
+		messages = append(messages, field.Field+" "+field.Message)
+	}
+	err := &InvalidParamsError{Err: errors.NewErr("%s: %s", ErrInvalidParams.message, strings.Join(messages, "; ")), Fields: fields}
+	err.SetLocation(1)
+	return err
+}
+
+// ArgumentError 编解码器无法解码参数. 错误码与 ErrInvalidParams 相同, 错误数据是它本身.
+// Index 为 -1 表示 params 整体无效, 此时没有 GoType 与 JSONType
+type ArgumentError struct {
+	errors.Err `json:"-"`
+	Index      int    `json:"index"`
+	GoType     string `json:"goType,omitempty"`
+	JSONType   string `json:"jsonType,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+func (err *ArgumentError) RPCErrorCode() int64       { return ErrInvalidParams.code }
+func (err *ArgumentError) RPCErrorMessage() string   { return err.Error() }
+func (err *ArgumentError) RPCErrorData() interface{} { return err }
+func (err *ArgumentError) Is(target error) bool      { return target == error(ErrInvalidParams) }
+
+// NewArgumentError 解码第 index 个参数失败, typ 是期望的类型,可以为 nil
+func NewArgumentError(index int, typ reflect.Type, format string, args ...interface{}) *ArgumentError {
+	err := &ArgumentError{Index: index, Reason: fmt.Sprintf(format, args...)}
+	if typ != nil {
+		err.GoType, err.JSONType = typ.String(), jsonType(typ)
+	}
+	if index < 0 {
+		err.Err = errors.NewErr("%s: %s", ErrInvalidParams.message, err.Reason)
+	} else {
+		err.Err = errors.NewErr("%s: argument %d: %s", ErrInvalidParams.message, index, err.Reason)
+	}
+	err.SetLocation(1)
+	return err
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// jsonType typ 对应的 JSON 类型. 自定义解码的类型无法确定时返回 "any"
+func jsonType(typ reflect.Type) string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch ptr := reflect.PtrTo(typ); {
+	case ptr.Implements(textUnmarshalerType):
+		return "string"
+	case ptr.Implements(jsonUnmarshalerType):
+		return "any"
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		return "array"
+	case reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return "any"
+	}
+}
+
+type rule struct {
+	name    string
+	message string
+	check   func(v reflect.Value) bool
+}
+
+type fieldValidator struct {
+	index int
+	name  string
+	rules []rule
+	// nested 字段的类型(或者指针,切片,映射的元素)是包含规则的结构体
+	nested *validator
+}
+
+// validator 校验一个结构体类型的值
+type validator struct {
+	fields []*fieldValidator
+}
+
+var validators sync.Map // map[reflect.Type]*validator
+
+// validatorOf 返回 typ 的 validator, typ 不包含任何规则时返回 nil. 规则无效时返回错误
+func validatorOf(typ reflect.Type) (*validator, error) {
+	if v, ok := validators.Load(typ); ok {
+		return v.(*validator), nil
+	}
+	v, err := compileValidator(typ, make(map[reflect.Type]*validator))
+	if err != nil {
+		return nil, err
+	}
+	validators.Store(typ, v)
+	return v, nil
+}
+
+// compileValidator seen 用来处理递归的类型
+func compileValidator(typ reflect.Type, seen map[reflect.Type]*validator) (*validator, error) {
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array || typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	if v, exist := seen[typ]; exist {
+		return v, nil
+	}
+	v := new(validator)
+	seen[typ] = v
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+		rules, err := parseRules(field.Tag.Get(ValidateTag), field.Type)
+		if err != nil {
+			return nil, errors.Annotate(err, "%s.%s", typ.String(), field.Name)
+		}
+		nested, err := compileValidator(field.Type, seen)
+		if err != nil {
+			return nil, err
+		}
+		if len(rules) > 0 || nested != nil {
+			v.fields = append(v.fields, &fieldValidator{index: i, name: name, rules: rules, nested: nested})
+		}
+	}
+	if len(v.fields) == 0 {
+		return nil, nil
+	}
+	return v, nil
+}
+
+func jsonFieldName(field reflect.StructField) (name string, skip bool) {
+	if field.PkgPath != "" {
+		return "", true
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	if name = strings.Split(tag, ",")[0]; name == "" {
+		name = field.Name
+	}
+	return name, false
+}
+
+func parseRules(tag string, typ reflect.Type) ([]rule, error) {
+	var rules []rule
+	for tag != "" {
+		var item string
+		if strings.HasPrefix(tag, "regex=") {
+			item, tag = tag, ""
+		} else if i := strings.IndexByte(tag, ','); i >= 0 {
+			item, tag = tag[:i], tag[i+1:]
+		} else {
+			item, tag = tag, ""
+		}
+		name, param := item, ""
+		if i := strings.IndexByte(item, '='); i >= 0 {
+			name, param = item[:i], item[i+1:]
+		}
+		r, err := makeRule(name, param, typ)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func makeRule(name, param string, typ reflect.Type) (rule, error) {
+	elem := typ
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	switch name {
+	case "required":
+		return rule{name: name, message: "is required", check: func(v reflect.Value) bool { return !v.IsZero() }}, nil
+	case "min", "max":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return rule{}, errors.Format("%s=%s is not a number", name, param)
+		}
+		measure := measureOf(elem)
+		if measure == nil {
+			return rule{}, errors.Format("%s doesn't apply to %s", name, typ.String())
+		}
+		if name == "min" {
+			return rule{name: name, message: "must be at least " + param, check: indirectCheck(func(v reflect.Value) bool { return measure(v) >= limit })}, nil
+		}
+		return rule{name: name, message: "must be at most " + param, check: indirectCheck(func(v reflect.Value) bool { return measure(v) <= limit })}, nil
+	case "enum":
+		switch elem.Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return rule{}, errors.Format("enum doesn't apply to %s", typ.String())
+		}
+		values := make(map[string]bool)
+		for _, value := range strings.Split(param, "|") {
+			values[value] = true
+		}
+		return rule{name: name, message: "must be one of " + param, check: indirectCheck(func(v reflect.Value) bool { return values[formatScalar(v)] })}, nil
+	case "regex":
+		if elem.Kind() != reflect.String {
+			return rule{}, errors.Format("regex doesn't apply to %s", typ.String())
+		}
+		re, err := regexp.Compile(param)
+		if err != nil {
+			return rule{}, errors.Annotate(err, "regex")
+		}
+		return rule{name: name, message: "must match " + param, check: indirectCheck(func(v reflect.Value) bool { return re.MatchString(v.String()) })}, nil
+	default:
+		return rule{}, errors.Format("unknown %s rule %q", ValidateTag, name)
+	}
+}
+
+// indirectCheck 指针为 nil 时不检查
+func indirectCheck(check func(v reflect.Value) bool) func(v reflect.Value) bool {
+	return func(v reflect.Value) bool {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return true
+			}
+			v = v.Elem()
+		}
+		return check(v)
+	}
+}
+
+// formatScalar 按照 Kind 格式化字符串与整数的值, 不使用类型的 String 方法
+func formatScalar(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// measureOf min, max 比较的值. 不支持的类型返回 nil
+func measureOf(typ reflect.Type) func(v reflect.Value) float64 {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(v reflect.Value) float64 { return float64(v.Int()) }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(v reflect.Value) float64 { return float64(v.Uint()) }
+	case reflect.Float32, reflect.Float64:
+		return func(v reflect.Value) float64 { return v.Float() }
+	case reflect.String:
+		return func(v reflect.Value) float64 { return float64(utf8.RuneCountInString(v.String())) }
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return func(v reflect.Value) float64 { return float64(v.Len()) }
+	default:
+		return nil
+	}
+}
+
+func (vd *validator) validate(v reflect.Value, path string, fields *[]FieldError) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			vd.validate(v.Elem(), path, fields)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			vd.validate(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fields)
+		}
+	case reflect.Map:
+		// 按照键排序,错误的顺序是确定的
+		keys := v.MapKeys()
+		names := make([]string, len(keys))
+		for i, key := range keys {
+			names[i] = formatScalar(key)
+		}
+		sort.Sort(mapKeys{keys, names})
+		for i, key := range keys {
+			vd.validate(v.MapIndex(key), path+"["+names[i]+"]", fields)
+		}
+	case reflect.Struct:
+		for _, field := range vd.fields {
+			fv, name := v.Field(field.index), path+"."+field.name
+			for _, r := range field.rules {
+				if !r.check(fv) {
+					*fields = append(*fields, FieldError{Field: name, Rule: r.name, Message: r.message})
+				}
+			}
+			if field.nested != nil {
+				field.nested.validate(fv, name, fields)
+			}
+		}
+	}
+}
+
+// mapKeys 按照格式化之后的键排序
+type mapKeys struct {
+	keys  []reflect.Value
+	names []string
+}
+
+func (m mapKeys) Len() int           { return len(m.keys) }
+func (m mapKeys) Less(i, j int) bool { return m.names[i] < m.names[j] }
+func (m mapKeys) Swap(i, j int) {
+	m.keys[i], m.keys[j] = m.keys[j], m.keys[i]
+	m.names[i], m.names[j] = m.names[j], m.names[i]
+}
+
+// compileValidators 在注册时检查参数类型的规则
+func compileValidators(cbs map[string]*callback) error {
+	for name, cb := range cbs {
+		for i := 0; i < len(cb.ins.Position); i++ {
+			typ, _ := cb.ins.ArgumentType(i)
+			if _, err := validatorOf(typ); err != nil {
+				return errors.Annotate(err, name)
+			}
+		}
+	}
+	return nil
+}
+
+// validate 在调用回调之前校验参数. 可变参数的每个元素单独校验
+func (cb *callback) validate(args []reflect.Value) error {
+	var fields []FieldError
+	for i, arg := range args {
+		typ, ok := cb.ins.ArgumentType(i)
+		if !ok {
+			break
+		}
+		if v, _ := validatorOf(typ); v != nil {
+			v.validate(arg, fmt.Sprintf("params[%d]", i), &fields)
+		}
+	}
+	if len(fields) > 0 {
+		return newInvalidParamsError(fields)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/smallsung/gopkg/rpc"
+	"github.com/smallsung/gopkg/rpc/jsonrpc"
+)
+
+type Item struct {
+	Name  string `json:"name" validate:"required,regex=^[a-z]+$"`
+	Count *int   `json:"count" validate:"min=1,max=10"`
+}
+
+type Order struct {
+	Kind  string `json:"kind" validate:"enum=retail|wholesale"`
+	Items []Item `json:"items" validate:"min=1"`
+}
+
+type orderService struct{}
+
+func (orderService) Place(order Order) int { return len(order.Items) }
+
+type BadRule struct {
+	Flag bool `validate:"min=1"`
+}
+
+type badService struct{}
+
+func (badService) Do(BadRule) {}
+
+func TestValidate(t *testing.T) {
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("order", orderService{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Register("bad", badService{}); err == nil {
+		t.Fatal("register invalid rule succeeded")
+	}
+	client := rpc.DialInProc(context.Background(), server, jsonrpc.NewClientCodec)
+	defer client.Close()
+	ctx := context.Background()
+
+	count := 2
+	var n int
+	if err := client.Call(ctx, "order.place", &n, Order{Kind: "retail", Items: []Item{{Name: "apple", Count: &count}, {Name: "pear"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	count = 11
+	err := client.Call(ctx, "order.place", &n, Order{Kind: "gift", Items: []Item{{Name: "Apple", Count: &count}, {}}})
+	me, ok := err.(*rpc.MessageError)
+	if !ok || me.Code != -32602 {
+		t.Fatalf("want invalid params, got %v", err)
+	}
+	var fields []rpc.FieldError
+	raw, _ := json.Marshal(me.Data)
+	if err = json.Unmarshal(raw, &fields); err != nil {
+		t.Fatal(err)
+	}
+	want := []rpc.FieldError{
+		{Field: "params[0].kind", Rule: "enum", Message: "must be one of retail|wholesale"},
+		{Field: "params[0].items[0].name", Rule: "regex", Message: "must match ^[a-z]+$"},
+		{Field: "params[0].items[0].count", Rule: "max", Message: "must be at most 10"},
+		{Field: "params[0].items[1].name", Rule: "required", Message: "is required"},
+		{Field: "params[0].items[1].name", Rule: "regex", Message: "must match ^[a-z]+$"},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("fields:\n%+v\nwant\n%+v", fields, want)
+	}
+}
+
+// Priority 的 String 不影响 enum 的比较
+type Priority int
+
+func (p Priority) String() string { return [...]string{"none", "low", "high"}[p%3] }
+
+type Task struct {
+	Priority Priority        `json:"priority" validate:"enum=1|2"`
+	Items    map[string]Item `json:"items"`
+}
+
+type taskService struct{}
+
+func (taskService) Add(task Task) int { return len(task.Items) }
+
+func TestValidateEnumAndMap(t *testing.T) {
+	server := rpc.NewServer(jsonrpc.NewServerCodec)
+	if err := server.Register("task", taskService{}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(context.Background(), server, jsonrpc.NewClientCodec)
+	defer client.Close()
+	ctx := context.Background()
+
+	var n int
+	if err := client.Call(ctx, "task.add", &n, Task{Priority: 2, Items: map[string]Item{"a": {Name: "apple"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := client.Call(ctx, "task.add", &n, Task{Priority: 3, Items: map[string]Item{"b": {Name: "Pear"}, "a": {}}})
+	me, ok := err.(*rpc.MessageError)
+	if !ok || me.Code != -32602 {
+		t.Fatalf("want invalid params, got %v", err)
+	}
+	var fields []rpc.FieldError
+	raw, _ := json.Marshal(me.Data)
+	if err = json.Unmarshal(raw, &fields); err != nil {
+		t.Fatal(err)
+	}
+	want := []rpc.FieldError{
+		{Field: "params[0].priority", Rule: "enum", Message: "must be one of 1|2"},
+		{Field: "params[0].items[a].name", Rule: "required", Message: "is required"},
+		{Field: "params[0].items[a].name", Rule: "regex", Message: "must match ^[a-z]+$"},
+		{Field: "params[0].items[b].name", Rule: "regex", Message: "must match ^[a-z]+$"},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("fields:\n%+v\nwant\n%+v", fields, want)
+	}
+}
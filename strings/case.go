@@ -0,0 +1,66 @@
+package strings2
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Words 按照 '_', '-', 空白与大小写边界拆分单词. 连续的大写字母视为一个单词,例如 "HTTPServer" 拆分为 "HTTP", "Server"
+func Words(str string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+	}
+	runes := []rune(str)
+	for i, r := range runes {
+		if r == '_' || r == '-' || unicode.IsSpace(r) {
+			flush()
+			continue
+		}
+		if len(word) > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
+
+// LowerCamelCase "GetHTTPStatus", "get_http_status" 都转换为 "getHttpStatus"
+func LowerCamelCase(str string) string {
+	words := Words(str)
+	for i, word := range words {
+		if i == 0 {
+			words[i] = strings.ToLower(word)
+		} else {
+			words[i] = UpperFirst(strings.ToLower(word))
+		}
+	}
+	return strings.Join(words, "")
+}
+
+// UpperCamelCase "getHTTPStatus", "get_http_status" 都转换为 "GetHttpStatus"
+func UpperCamelCase(str string) string {
+	words := Words(str)
+	for i, word := range words {
+		words[i] = UpperFirst(strings.ToLower(word))
+	}
+	return strings.Join(words, "")
+}
+
+// SnakeCase "GetHTTPStatus", "getHttpStatus" 都转换为 "get_http_status"
+func SnakeCase(str string) string {
+	words := Words(str)
+	for i, word := range words {
+		words[i] = strings.ToLower(word)
+	}
+	return strings.Join(words, "_")
+}
@@ -0,0 +1,31 @@
+package strings2_test
+
+import (
+	"testing"
+
+	strings2 "github.com/smallsung/gopkg/strings"
+)
+
+func TestCase(t *testing.T) {
+	tests := []struct {
+		in, lowerCamel, upperCamel, snake string
+	}{
+		{"GetHTTPStatus", "getHttpStatus", "GetHttpStatus", "get_http_status"},
+		{"get_http_status", "getHttpStatus", "GetHttpStatus", "get_http_status"},
+		{"ID", "id", "Id", "id"},
+		{"Sha256Sum", "sha256Sum", "Sha256Sum", "sha256_sum"},
+		{"blockNumber", "blockNumber", "BlockNumber", "block_number"},
+		{"", "", "", ""},
+	}
+	for _, test := range tests {
+		if got := strings2.LowerCamelCase(test.in); got != test.lowerCamel {
+			t.Errorf("LowerCamelCase(%q) = %q, want %q", test.in, got, test.lowerCamel)
+		}
+		if got := strings2.UpperCamelCase(test.in); got != test.upperCamel {
+			t.Errorf("UpperCamelCase(%q) = %q, want %q", test.in, got, test.upperCamel)
+		}
+		if got := strings2.SnakeCase(test.in); got != test.snake {
+			t.Errorf("SnakeCase(%q) = %q, want %q", test.in, got, test.snake)
+		}
+	}
+}